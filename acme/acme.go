@@ -0,0 +1,180 @@
+// Package acme solves ACME DNS-01 challenges with UniFi DNS policies. It
+// publishes the challenge TXT record and waits until the gateway's resolver
+// serves it, since the resolver picks up new policies with a delay and a
+// certificate authority checking too early fails the challenge.
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/unifi/internal/dnswire"
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// Defaults used when the corresponding Solver fields are zero.
+const (
+	DefaultTimeout  = 2 * time.Minute
+	DefaultInterval = 2 * time.Second
+)
+
+// ChallengeName is the label prepended to a domain name to form the name
+// of its DNS-01 challenge record.
+const ChallengeName = "_acme-challenge"
+
+// Provider is the set of libdns interfaces the solver needs.
+type Provider interface {
+	libdns.RecordAppender
+	libdns.RecordDeleter
+}
+
+// Solver publishes DNS-01 challenge records.
+type Solver struct {
+	// Provider manages the records.
+	Provider Provider
+
+	// Resolver is the address of the gateway's DNS resolver, e.g.
+	// "192.168.1.1" or "192.168.1.1:53". The port defaults to 53.
+	Resolver string
+
+	// Timeout bounds waiting for the record to be served.
+	// Defaults to DefaultTimeout.
+	Timeout time.Duration
+
+	// Interval between queries. Defaults to DefaultInterval.
+	Interval time.Duration
+
+	// TTL of the challenge record.
+	TTL time.Duration
+}
+
+// Challenge identifies a challenge record: the TXT record Name, relative
+// to Zone, with the key authorization digest as its Value.
+type Challenge struct {
+	Zone  string
+	Name  string
+	Value string
+}
+
+// NewChallenge returns the challenge for domain in zone, whose record is
+// named _acme-challenge.<domain>. For a wildcard domain such as
+// *.example.com, the record is that of the domain without the wildcard.
+func NewChallenge(zone, domain, value string) Challenge {
+	domain = strings.TrimPrefix(strings.TrimSuffix(domain, "."), "*.")
+	name := unifi.RelativeName(ChallengeName+"."+domain, zone)
+	return Challenge{Zone: zone, Name: name, Value: value}
+}
+
+// Solve presents the challenge, calls fn once the resolver serves it and
+// cleans up afterwards, whether or not fn succeeded.
+func (s *Solver) Solve(ctx context.Context, c Challenge, fn func(ctx context.Context) error) error {
+	if err := s.Present(ctx, c); err != nil {
+		return err
+	}
+
+	err := fn(ctx)
+	if cleanupErr := s.CleanUp(context.Background(), c); cleanupErr != nil && err == nil {
+		err = cleanupErr
+	}
+	return err
+}
+
+// Present appends the challenge record and waits until the resolver serves
+// its value. If waiting fails, the record is removed again.
+func (s *Solver) Present(ctx context.Context, c Challenge) error {
+	if s.Resolver == "" {
+		return errors.New("resolver address is required")
+	}
+
+	if _, err := s.Provider.AppendRecords(ctx, c.Zone, []libdns.Record{s.record(c)}); err != nil {
+		return fmt.Errorf("failed to append challenge record: %w", err)
+	}
+
+	if err := s.Wait(ctx, c); err != nil {
+		if cleanupErr := s.CleanUp(context.Background(), c); cleanupErr != nil {
+			return fmt.Errorf("%w (and cleaning up failed: %v)", err, cleanupErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// CleanUp deletes the challenge record.
+func (s *Solver) CleanUp(ctx context.Context, c Challenge) error {
+	if _, err := s.Provider.DeleteRecords(ctx, c.Zone, []libdns.Record{s.record(c)}); err != nil {
+		return fmt.Errorf("failed to delete challenge record: %w", err)
+	}
+	return nil
+}
+
+// Wait queries the resolver for the challenge record until it serves the
+// value or the timeout elapses.
+func (s *Solver) Wait(ctx context.Context, c Challenge) error {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	fqdn := libdns.AbsoluteName(c.Name, c.Zone)
+	addr := dnswire.HostPort(s.Resolver)
+
+	var lastErr error
+	for {
+		// A lost datagram must not stall the loop, so each query gets
+		// one interval to be answered
+		queryCtx, cancelQuery := context.WithTimeout(ctx, interval)
+		found, err := lookupTXT(queryCtx, addr, fqdn, c.Value)
+		cancelQuery()
+		if found {
+			return nil
+		}
+		if err != nil {
+			lastErr = err
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if lastErr != nil {
+				return fmt.Errorf("challenge record %s not served by %s within %s: %w", fqdn, addr, timeout, lastErr)
+			}
+			return fmt.Errorf("challenge record %s not served by %s within %s", fqdn, addr, timeout)
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Solver) record(c Challenge) libdns.TXT {
+	return libdns.TXT{Name: c.Name, Text: c.Value, TTL: s.TTL}
+}
+
+// lookupTXT reports whether the resolver at addr serves a TXT record at
+// fqdn with value. The strings of a record are joined before comparing.
+func lookupTXT(ctx context.Context, addr, fqdn, value string) (bool, error) {
+	resp, err := dnswire.Exchange(ctx, addr, dnswire.NewQuery(fqdn, dnswire.TypeTXT))
+	if err != nil {
+		return false, err
+	}
+	if resp.RCode != dnswire.RCodeSuccess && resp.RCode != dnswire.RCodeNameError {
+		return false, fmt.Errorf("resolver returned rcode %d", resp.RCode)
+	}
+
+	for _, rr := range resp.Answers {
+		if rr.Type == dnswire.TypeTXT && strings.Join(rr.Text, "") == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,103 @@
+package acme_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/unifi"
+	"github.com/libdns/unifi/acme"
+	"github.com/libdns/unifi/internal/unifitest"
+)
+
+// newSolver starts a fake controller, closed when the test ends, and returns
+// it with a solver using it
+func newSolver(t *testing.T) (*unifitest.Server, *acme.Solver) {
+	t.Helper()
+
+	fake := unifitest.NewServer()
+	t.Cleanup(fake.Close)
+
+	return fake, &acme.Solver{
+		Provider: &unifi.Provider{
+			APIKey:  fake.APIKey,
+			SiteId:  fake.SiteID,
+			BaseUrl: fake.BaseURL(),
+		},
+		Resolver: fake.StartDNS(),
+		Timeout:  2 * time.Second,
+		Interval: 10 * time.Millisecond,
+	}
+}
+
+func TestNewChallenge(t *testing.T) {
+	c := acme.NewChallenge("example.com.", "www.example.com", "digest")
+	if c.Name != "_acme-challenge.www" || c.Zone != "example.com." || c.Value != "digest" {
+		t.Errorf("Unexpected challenge: %+v", c)
+	}
+
+	// The record of a wildcard certificate is that of its base domain
+	for _, domain := range []string{"*.example.com", "*.example.com."} {
+		if c := acme.NewChallenge("example.com", domain, "digest"); c.Name != "_acme-challenge" {
+			t.Errorf("Unexpected challenge for %s: %+v", domain, c)
+		}
+	}
+}
+
+// TestSolveWaitsForResolver tests that fn runs only once the resolver serves the record
+func TestSolveWaitsForResolver(t *testing.T) {
+	fake, solver := newSolver(t)
+	fake.SetDNSDelay(100 * time.Millisecond)
+	challenge := acme.NewChallenge("example.com", "www.example.com", "digest")
+
+	start := time.Now()
+	err := solver.Solve(context.Background(), challenge, func(ctx context.Context) error {
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("Challenge presented after %s, before the resolver served it", elapsed)
+		}
+		if len(fake.Policies()) != 1 || fake.Policies()[0].Domain != "_acme-challenge.www.example.com" {
+			t.Errorf("Unexpected policies: %+v", fake.Policies())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Solve failed: %v", err)
+	}
+	if n := len(fake.Policies()); n != 0 {
+		t.Errorf("Expected challenge record to be cleaned up, %d policies left", n)
+	}
+}
+
+// TestSolveCleansUpOnError tests that the record is removed when fn fails
+func TestSolveCleansUpOnError(t *testing.T) {
+	fake, solver := newSolver(t)
+	challenge := acme.NewChallenge("example.com", "example.com", "digest")
+
+	errValidation := errors.New("validation failed")
+	err := solver.Solve(context.Background(), challenge, func(ctx context.Context) error {
+		return errValidation
+	})
+	if !errors.Is(err, errValidation) {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+	if n := len(fake.Policies()); n != 0 {
+		t.Errorf("Expected challenge record to be cleaned up, %d policies left", n)
+	}
+}
+
+// TestPresentTimeout tests that a record the resolver never serves is reported and removed
+func TestPresentTimeout(t *testing.T) {
+	fake, solver := newSolver(t)
+	fake.SetDNSDelay(time.Hour)
+	solver.Timeout = 100 * time.Millisecond
+
+	err := solver.Present(context.Background(), acme.NewChallenge("example.com", "www.example.com", "digest"))
+	if err == nil || !strings.Contains(err.Error(), "not served by") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if n := len(fake.Policies()); n != 0 {
+		t.Errorf("Expected challenge record to be cleaned up, %d policies left", n)
+	}
+}
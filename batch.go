@@ -0,0 +1,137 @@
+package unifi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// APIError is returned when the controller answers a request with an
+// error status.
+type APIError = unifi.APIError
+
+// BatchError is returned when several operations of a single call fail.
+// Errors are in the order of the records they belong to.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d operations failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the individual errors.
+func (e *BatchError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is reports whether any of the individual errors matches target. It
+// makes errors.Is look into a BatchError before Go 1.20, which does not
+// use Unwrap() []error.
+func (e *BatchError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first individual error that matches target, like Is.
+func (e *BatchError) As(target any) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// forEach calls fn for every index in [0, n), running up to p.Concurrency
+// calls in parallel. Once a call fails no further calls are started, and the
+// errors of all calls that ran are returned.
+func (p *Provider) forEach(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	workers := p.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	errs := make([]error, n)
+	indexes := make(chan int)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				// The dispatcher may hand out an index after a call
+				// failed, since select picks among ready cases at random
+				select {
+				case <-stop:
+					continue
+				default:
+				}
+				if errs[i] = fn(ctx, i); errs[i] != nil {
+					stopOnce.Do(func() { close(stop) })
+				}
+			}
+		}()
+	}
+
+	var interrupted error
+dispatch:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-stop:
+			break dispatch
+		case <-ctx.Done():
+			interrupted = ctx.Err()
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	switch {
+	case len(failed) == 1:
+		return failed[0]
+	case len(failed) > 1:
+		return &BatchError{Errors: failed}
+	}
+	return interrupted
+}
+
+// completed returns the records of the calls that succeeded, in input
+// order. Calls that failed or did not run leave their slot nil.
+func completed(records []libdns.Record) []libdns.Record {
+	var done []libdns.Record
+	for _, record := range records {
+		if record != nil {
+			done = append(done, record)
+		}
+	}
+	return done
+}
@@ -0,0 +1,124 @@
+package unifi
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// policyCache holds the policies of a site and zone as last seen by the provider.
+type policyCache struct {
+	siteID    string
+	zone      string
+	policies  []unifi.DNSPolicy
+	fetchedAt time.Time
+}
+
+// Invalidate drops the cached policies of the zone, or of all zones if zone is empty.
+func (p *Provider) Invalidate(zone string) {
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+
+	for key, entry := range p.cache {
+		if zone == "" || unifi.SameName(entry.zone, zone) {
+			delete(p.cache, key)
+		}
+	}
+}
+
+// listPolicies returns the policies of the zone, from the cache if it is
+// enabled and fresh. The returned slice is owned by the caller.
+func (p *Provider) listPolicies(ctx context.Context, client *unifi.Client, zone string) ([]unifi.DNSPolicy, error) {
+	if p.CacheTTL <= 0 {
+		return client.ListPolicies(ctx, p.siteID, zone)
+	}
+
+	key := p.siteID + "/" + strings.ToLower(strings.TrimSuffix(zone, "."))
+
+	p.cacheMu.Lock()
+	entry, ok := p.cache[key]
+	if ok && time.Since(entry.fetchedAt) < p.CacheTTL {
+		policies := clonePolicies(entry.policies)
+		p.cacheMu.Unlock()
+		return policies, nil
+	}
+	p.cacheMu.Unlock()
+
+	policies, err := client.ListPolicies(ctx, p.siteID, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	p.cacheMu.Lock()
+	if p.cache == nil {
+		p.cache = make(map[string]*policyCache)
+	}
+	p.cache[key] = &policyCache{
+		siteID:    p.siteID,
+		zone:      zone,
+		policies:  clonePolicies(policies),
+		fetchedAt: time.Now(),
+	}
+	p.cacheMu.Unlock()
+
+	return policies, nil
+}
+
+// clonePolicies returns a deep copy of policies, so that callers cannot
+// change the cached policies through the returned ones.
+func clonePolicies(policies []unifi.DNSPolicy) []unifi.DNSPolicy {
+	clones := make([]unifi.DNSPolicy, len(policies))
+	for i, policy := range policies {
+		clones[i] = policy.Clone()
+	}
+	return clones
+}
+
+// cachePut records a created or updated policy in the cache of the zone.
+func (p *Provider) cachePut(zone string, policy unifi.DNSPolicy) {
+	p.updateCache(zone, policy, func(entry *policyCache) {
+		for i := range entry.policies {
+			if entry.policies[i].ID == policy.ID {
+				entry.policies[i] = policy.Clone()
+				return
+			}
+		}
+		entry.policies = append(entry.policies, policy.Clone())
+	})
+}
+
+// cacheRemove drops a deleted policy from the cache of the zone.
+func (p *Provider) cacheRemove(zone string, policy unifi.DNSPolicy) {
+	p.updateCache(zone, policy, func(entry *policyCache) {
+		for i := range entry.policies {
+			if entry.policies[i].ID == policy.ID {
+				entry.policies = append(entry.policies[:i], entry.policies[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// updateCache applies fn to the cache of the zone. Cached overlapping zones
+// of the same site that may contain the policy are invalidated instead.
+func (p *Provider) updateCache(zone string, policy unifi.DNSPolicy, fn func(*policyCache)) {
+	if p.CacheTTL <= 0 {
+		return
+	}
+
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+
+	for key, entry := range p.cache {
+		if entry.siteID != p.siteID {
+			continue
+		}
+		if unifi.SameName(entry.zone, zone) {
+			fn(entry)
+		} else if unifi.InZone(policy.Domain, entry.zone) {
+			delete(p.cache, key)
+		}
+	}
+}
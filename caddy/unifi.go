@@ -0,0 +1,126 @@
+// Package unifi is a Caddy module that manages DNS records in UniFi
+// Network DNS policies, for use with the ACME DNS-01 challenge.
+package unifi
+
+import (
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/libdns/unifi"
+)
+
+// Provider lets Caddy read and manipulate DNS records in UniFi DNS policies.
+type Provider struct{ *unifi.Provider }
+
+func init() {
+	caddy.RegisterModule(Provider{})
+}
+
+// CaddyModule returns the Caddy module information.
+func (Provider) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "dns.providers.unifi",
+		New: func() caddy.Module { return &Provider{new(unifi.Provider)} },
+	}
+}
+
+// Provision expands placeholders such as {env.UNIFI_API_KEY} in the
+// configuration and validates it. Implements caddy.Provisioner.
+func (p *Provider) Provision(ctx caddy.Context) error {
+	repl := caddy.NewReplacer()
+	for _, field := range []*string{
+		&p.Provider.APIKey,
+		&p.Provider.SiteId,
+		&p.Provider.BaseUrl,
+		&p.Provider.TLSCAFile,
+		&p.Provider.EnvPrefix,
+		&p.Provider.ConfigFile,
+	} {
+		value, err := repl.ReplaceOrErr(*field, true, true)
+		if err != nil {
+			return fmt.Errorf("unifi: %w", err)
+		}
+		*field = value
+	}
+
+	p.Provider.Logger = ctx.Slogger()
+
+	if err := p.Provider.Validate(); err != nil {
+		return fmt.Errorf("unifi: %w", err)
+	}
+	return nil
+}
+
+// UnmarshalCaddyfile sets up the DNS provider from Caddyfile tokens. Syntax:
+//
+//	unifi [<api_key>] {
+//	    api_key <api_key>
+//	    site_id <site_id>
+//	    base_url <base_url>
+//	    tls_verify
+//	    tls_ca_file <path>
+//	}
+//
+// Values left out are read from the UNIFI_* environment variables.
+func (p *Provider) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			p.Provider.APIKey = d.Val()
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+
+		for nesting := d.Nesting(); d.NextBlock(nesting); {
+			switch d.Val() {
+			case "api_key":
+				if err := setString(d, &p.Provider.APIKey); err != nil {
+					return err
+				}
+			case "site_id":
+				if err := setString(d, &p.Provider.SiteId); err != nil {
+					return err
+				}
+			case "base_url":
+				if err := setString(d, &p.Provider.BaseUrl); err != nil {
+					return err
+				}
+			case "tls_verify":
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+				p.Provider.TLSVerify = true
+			case "tls_ca_file":
+				if err := setString(d, &p.Provider.TLSCAFile); err != nil {
+					return err
+				}
+			default:
+				return d.Errf("unrecognized subdirective '%s'", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+// setString sets dest to the single argument of the current subdirective.
+func setString(d *caddyfile.Dispenser, dest *string) error {
+	name := d.Val()
+	if *dest != "" {
+		return d.Errf("%s already set", name)
+	}
+	if !d.NextArg() {
+		return d.ArgErr()
+	}
+	*dest = d.Val()
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddyfile.Unmarshaler = (*Provider)(nil)
+	_ caddy.Provisioner     = (*Provider)(nil)
+)
@@ -0,0 +1,109 @@
+package unifi
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/libdns/unifi"
+)
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *unifi.Provider
+		wantErr string
+	}{
+		{
+			name:  "inline API key",
+			input: `unifi {env.UNIFI_API_KEY}`,
+			want:  &unifi.Provider{APIKey: "{env.UNIFI_API_KEY}"},
+		},
+		{
+			name: "block",
+			input: `unifi {
+				api_key key
+				site_id site
+				base_url 192.168.1.1
+				tls_verify
+				tls_ca_file /etc/unifi/ca.pem
+			}`,
+			want: &unifi.Provider{
+				APIKey:    "key",
+				SiteId:    "site",
+				BaseUrl:   "192.168.1.1",
+				TLSVerify: true,
+				TLSCAFile: "/etc/unifi/ca.pem",
+			},
+		},
+		{
+			name:    "API key set twice",
+			input:   "unifi key {\n api_key other\n}",
+			wantErr: "api_key already set",
+		},
+		{
+			name:    "missing argument",
+			input:   "unifi {\n site_id\n}",
+			wantErr: "wrong argument count",
+		},
+		{
+			name:    "unknown subdirective",
+			input:   "unifi {\n token key\n}",
+			wantErr: "unrecognized subdirective 'token'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{new(unifi.Provider)}
+			err := p.UnmarshalCaddyfile(caddyfile.NewTestDispenser(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalCaddyfile failed: %v", err)
+			}
+			if got := p.Provider; got.APIKey != tt.want.APIKey || got.SiteId != tt.want.SiteId || got.BaseUrl != tt.want.BaseUrl ||
+				got.TLSVerify != tt.want.TLSVerify || got.TLSCAFile != tt.want.TLSCAFile {
+				t.Errorf("Expected api_key=%q site_id=%q base_url=%q tls_verify=%v tls_ca_file=%q, got %q %q %q %v %q",
+					tt.want.APIKey, tt.want.SiteId, tt.want.BaseUrl, tt.want.TLSVerify, tt.want.TLSCAFile,
+					got.APIKey, got.SiteId, got.BaseUrl, got.TLSVerify, got.TLSCAFile)
+			}
+		})
+	}
+}
+
+func TestProvision(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	t.Setenv("UNIFI_TEST_API_KEY", "key-from-env")
+
+	p := &Provider{&unifi.Provider{
+		APIKey:  "{env.UNIFI_TEST_API_KEY}",
+		SiteId:  "site",
+		BaseUrl: "192.168.1.1",
+	}}
+	if err := p.Provision(ctx); err != nil {
+		t.Fatalf("Provision failed: %v", err)
+	}
+	if p.Provider.APIKey != "key-from-env" {
+		t.Errorf("Expected placeholder to be expanded, got %q", p.Provider.APIKey)
+	}
+
+	p = &Provider{&unifi.Provider{
+		APIKey:    "key",
+		SiteId:    "site",
+		BaseUrl:   "ftp://192.168.1.1",
+		EnvPrefix: "UNIFI_TEST_",
+	}}
+	if err := p.Provision(ctx); err == nil || !strings.Contains(err.Error(), "scheme must be https or http") {
+		t.Errorf("Expected invalid base URL error, got %v", err)
+	}
+}
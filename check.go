@@ -0,0 +1,176 @@
+package unifi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// CheckStatus is the outcome of a single check.
+type CheckStatus string
+
+const (
+	CheckOK      CheckStatus = "ok"
+	CheckFailed  CheckStatus = "failed"
+	CheckSkipped CheckStatus = "skipped"
+)
+
+// Names of the checks performed by Check, in order.
+const (
+	CheckConfig     = "config"
+	CheckController = "controller"
+	CheckAPIKey     = "api_key"
+	CheckSite       = "site"
+	CheckPolicies   = "dns_policies"
+)
+
+// CheckResult is the outcome of one check with a human-readable detail.
+type CheckResult struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// CheckReport is the result of Check. Checks that depend on a failed
+// check are reported as skipped.
+type CheckReport struct {
+	BaseURL string        `json:"base_url,omitempty"`
+	SiteID  string        `json:"site_id,omitempty"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+// OK reports whether no check failed.
+func (r CheckReport) OK() bool {
+	return r.Err() == nil
+}
+
+// Err returns an error describing the first failed check, or nil.
+func (r CheckReport) Err() error {
+	for _, c := range r.Checks {
+		if c.Status == CheckFailed {
+			return fmt.Errorf("%s check failed: %s", c.Name, c.Error)
+		}
+	}
+	return nil
+}
+
+func (r *CheckReport) add(name string, status CheckStatus, detail string, err error) {
+	result := CheckResult{Name: name, Status: status, Detail: detail}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	r.Checks = append(r.Checks, result)
+}
+
+// skip adds the named checks as skipped.
+func (r *CheckReport) skip(names ...string) {
+	for _, name := range names {
+		r.add(name, CheckSkipped, "", nil)
+	}
+}
+
+// Check verifies the configuration, API key and site without changing any
+// records: it loads the configuration, reaches the controller, lists the
+// sites the key has access to, looks up the configured site and reads its
+// DNS policies. Write permission cannot be verified without writing.
+func (p *Provider) Check(ctx context.Context) (report CheckReport) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	ctx, span := p.startSpan(ctx, "Check", "", 0)
+	defer func() { p.endSpan(span, report.Err()) }()
+
+	cfg, err := p.LoadConfig()
+	if err != nil {
+		report.add(CheckConfig, CheckFailed, "", err)
+		report.skip(CheckController, CheckAPIKey, CheckSite, CheckPolicies)
+		return report
+	}
+	client, err := p.getClient()
+	if err != nil {
+		report.add(CheckConfig, CheckFailed, cfg.String(), err)
+		report.skip(CheckController, CheckAPIKey, CheckSite, CheckPolicies)
+		return report
+	}
+	report.SiteID = cfg.SiteID.Value
+	report.add(CheckConfig, CheckOK, cfg.String(), nil)
+
+	report.BaseURL, err = client.BaseURL(ctx)
+	if err != nil {
+		report.add(CheckController, CheckFailed, "", err)
+		report.skip(CheckAPIKey, CheckSite, CheckPolicies)
+		return report
+	}
+
+	sites, err := client.ListSites(ctx)
+	if err != nil {
+		if !isStatus(err, http.StatusUnauthorized, http.StatusForbidden) {
+			report.add(CheckController, CheckFailed, report.BaseURL, err)
+			report.skip(CheckAPIKey, CheckSite, CheckPolicies)
+			return report
+		}
+		report.add(CheckController, CheckOK, report.BaseURL, nil)
+		report.add(CheckAPIKey, CheckFailed, "", fmt.Errorf("API key rejected: %w", err))
+		report.skip(CheckSite, CheckPolicies)
+		return report
+	}
+	report.add(CheckController, CheckOK, report.BaseURL, nil)
+	report.add(CheckAPIKey, CheckOK, fmt.Sprintf("key has access to %d site(s)", len(sites)), nil)
+
+	site, ok := findSite(sites, report.SiteID)
+	if !ok {
+		report.add(CheckSite, CheckFailed, "", fmt.Errorf("site %s not found; available sites: %s", report.SiteID, describeSites(sites)))
+		report.skip(CheckPolicies)
+		return report
+	}
+	report.add(CheckSite, CheckOK, fmt.Sprintf("%s (%s)", site.Name, site.InternalReference), nil)
+
+	count, err := client.CountPolicies(ctx, report.SiteID)
+	if err != nil {
+		report.add(CheckPolicies, CheckFailed, "", err)
+		return report
+	}
+	report.add(CheckPolicies, CheckOK, fmt.Sprintf("%d DNS policies readable", count), nil)
+
+	return report
+}
+
+// isStatus reports whether err is an API error with one of the status codes.
+func isStatus(err error, codes ...int) bool {
+	var apiErr *unifi.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func findSite(sites []unifi.Site, id string) (unifi.Site, bool) {
+	for _, site := range sites {
+		if site.ID == id {
+			return site, true
+		}
+	}
+	return unifi.Site{}, false
+}
+
+func describeSites(sites []unifi.Site) string {
+	if len(sites) == 0 {
+		return "none"
+	}
+
+	names := make([]string, 0, len(sites))
+	for _, site := range sites {
+		names = append(names, fmt.Sprintf("%s (%s)", site.ID, site.Name))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/libdns/unifi"
+	"github.com/libdns/unifi/ddns"
+)
+
+// runDDNS keeps a host's address records up to date until interrupted.
+func runDDNS(args []string) error {
+	fs := flag.NewFlagSet("ddns", flag.ExitOnError)
+	zone := fs.String("zone", "", "zone of the record (required)")
+	name := fs.String("name", "", "record name relative to the zone (required)")
+	ttl := fs.Duration("ttl", 5*time.Minute, "TTL of the records")
+	iface := fs.String("interface", "", "read addresses of this interface (default: all interfaces)")
+	command := fs.String("command", "", "read addresses from the output of this command")
+	file := fs.String("file", "", "read addresses from this file")
+	interval := fs.Duration("interval", ddns.DefaultInterval, "time between checks")
+	jitter := fs.Duration("jitter", 30*time.Second, "maximum random delay added to each interval")
+	stateFile := fs.String("state", "", "file remembering the last published addresses")
+	once := fs.Bool("once", false, "update once and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *zone == "" || *name == "" {
+		return errors.New("-zone and -name are required")
+	}
+
+	var source ddns.AddressSource
+	switch {
+	case *command != "" && *file != "":
+		return errors.New("-command and -file are mutually exclusive")
+	case *command != "":
+		fields := strings.Fields(*command)
+		if len(fields) == 0 {
+			return errors.New("-command must name a program to run")
+		}
+		source = ddns.CommandSource{Command: fields[0], Args: fields[1:]}
+	case *file != "":
+		source = ddns.FileSource{Path: *file}
+	default:
+		source = ddns.InterfaceSource{Interface: *iface}
+	}
+
+	updater := &ddns.Updater{
+		Provider:  &unifi.Provider{},
+		Zone:      *zone,
+		Name:      *name,
+		TTL:       *ttl,
+		Source:    source,
+		Interval:  *interval,
+		Jitter:    *jitter,
+		StateFile: *stateFile,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		changed, err := updater.Update(ctx)
+		if err == nil && !changed {
+			log.Print("addresses unchanged")
+		}
+		return err
+	}
+
+	if err := updater.Run(ctx); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/libdns/unifi"
+)
+
+// runDoctor checks the configuration, API key and site without changing
+// any records, and fails if any check fails.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 30*time.Second, "time limit for all checks")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	provider := &unifi.Provider{Timeout: *timeout}
+	report := provider.Check(context.Background())
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		return report.Err()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, check := range report.Checks {
+		message := check.Detail
+		if check.Error != "" {
+			message = check.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, check.Status, message)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return report.Err()
+}
@@ -0,0 +1,61 @@
+// Command libdns-unifi runs services that manage UniFi DNS policies.
+//
+// Credentials are read from the UNIFI_API_KEY, UNIFI_SITE_ID and
+// UNIFI_BASE_URL environment variables.
+//
+// Usage:
+//
+//	libdns-unifi <command> [flags]
+//
+// Commands:
+//
+//	ddns      keep a host's A/AAAA records up to date
+//	doctor    check the configuration, API key and site
+//	webhook   run an external-dns webhook provider
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// commands maps subcommand names to their entry points.
+var commands = map[string]func(args []string) error{
+	"ddns":    runDDNS,
+	"doctor":  runDoctor,
+	"webhook": runWebhook,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: libdns-unifi <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", name)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/libdns/unifi"
+	"github.com/libdns/unifi/webhook"
+)
+
+// runWebhook serves the external-dns webhook API and its health probes
+// until interrupted.
+func runWebhook(args []string) error {
+	fs := flag.NewFlagSet("webhook", flag.ExitOnError)
+	listen := fs.String("listen", "localhost:8888", "address of the webhook API")
+	healthListen := fs.String("health-listen", ":8080", "address of the /healthz and /readyz probes")
+	include := fs.String("domain-filter", os.Getenv("DOMAIN_FILTER"), "comma-separated zones to manage (or set DOMAIN_FILTER env var)")
+	exclude := fs.String("exclude-domains", os.Getenv("EXCLUDE_DOMAINS"), "comma-separated domains to ignore (or set EXCLUDE_DOMAINS env var)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := webhook.DomainFilter{
+		Include: splitList(*include),
+		Exclude: splitList(*exclude),
+	}
+	if len(filter.Include) == 0 {
+		return errors.New("at least one zone is required (set -domain-filter or DOMAIN_FILTER env var)")
+	}
+
+	server := webhook.New(&unifi.Provider{}, filter)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	servers := []*http.Server{
+		{Addr: *listen, Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second},
+		{Addr: *healthListen, Handler: server.HealthHandler(), ReadHeaderTimeout: 10 * time.Second},
+	}
+
+	errc := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			log.Printf("listening on %s", srv.Addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errc <- err
+			}
+		}(srv)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errc:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, srv := range servers {
+		_ = srv.Shutdown(shutdownCtx)
+	}
+
+	return err
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,313 @@
+package unifi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables read by the
+// provider when EnvPrefix is empty.
+const DefaultEnvPrefix = "UNIFI_"
+
+// Source identifies where a configuration value came from.
+type Source string
+
+// Configuration sources, in order of precedence.
+const (
+	SourceField   Source = "field"    // a Provider struct field
+	SourceEnv     Source = "env"      // an environment variable
+	SourceEnvFile Source = "env_file" // a file named by a *_FILE environment variable
+	SourceFile    Source = "file"     // the configuration file
+)
+
+// ConfigValue is a resolved configuration value and its origin.
+type ConfigValue struct {
+	Value  string
+	Source Source
+
+	// Origin names the field, environment variable or file the value was read from.
+	Origin string
+}
+
+// Config is the resolved configuration of a Provider.
+type Config struct {
+	APIKey  ConfigValue
+	SiteID  ConfigValue
+	BaseURL ConfigValue
+}
+
+// String describes where each value came from, without revealing the API key.
+func (c Config) String() string {
+	describe := func(name string, v ConfigValue) string {
+		if v.Value == "" {
+			return name + ": unset"
+		}
+		return fmt.Sprintf("%s: %s (%s)", name, v.Origin, v.Source)
+	}
+	return strings.Join([]string{
+		describe("api_key", c.APIKey),
+		describe("site_id", c.SiteID),
+		fmt.Sprintf("%s = %q", describe("base_url", c.BaseURL), c.BaseURL.Value),
+	}, ", ")
+}
+
+// configKey describes one configuration value and where to look for it.
+type configKey struct {
+	name  string // key in configuration files and suffix of environment variables
+	field string // Provider field name
+	label string // human readable name
+}
+
+var (
+	apiKeyKey  = configKey{name: "api_key", field: "APIKey", label: "API key"}
+	siteIDKey  = configKey{name: "site_id", field: "SiteId", label: "site ID"}
+	baseURLKey = configKey{name: "base_url", field: "BaseUrl", label: "base URL"}
+)
+
+// LoadConfig resolves the API key, site ID and base URL from, in order of
+// precedence: the struct fields; the environment variables API_KEY, SITE_ID
+// and BASE_URL with the EnvPrefix; files named by the same variables with a
+// _FILE suffix (e.g. for Docker secrets); and the file named by ConfigFile
+// or the CONFIG_FILE environment variable, a JSON object or key-value lines
+// (see Provider.ConfigFile).
+//
+// The API key is optional if Credentials is set.
+// It returns an error if a value is missing, set both directly and through
+// a _FILE variable, or if a file cannot be read. The configuration file is
+// only read if a value is not set by the other sources.
+func (p *Provider) LoadConfig() (Config, error) {
+	prefix := p.EnvPrefix
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	if !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+
+	configFile := ConfigValue{Value: p.ConfigFile, Source: SourceField, Origin: "ConfigFile"}
+	if configFile.Value == "" {
+		configFile = ConfigValue{Value: os.Getenv(prefix + "CONFIG_FILE"), Source: SourceEnv, Origin: prefix + "CONFIG_FILE"}
+	}
+
+	// The file is read only once a value is not found elsewhere
+	var file map[string]string
+	var loaded bool
+	readFile := func() (map[string]string, error) {
+		if loaded || configFile.Value == "" {
+			return file, nil
+		}
+		var err error
+		if file, err = readConfigFile(configFile.Value); err != nil {
+			return nil, fmt.Errorf("failed to load config file %s (from %s): %w", configFile.Value, configFile.Origin, err)
+		}
+		loaded = true
+		return file, nil
+	}
+
+	var cfg Config
+	var missing []string
+	for _, v := range []struct {
+		key   configKey
+		field string
+		dest  *ConfigValue
+	}{
+		{apiKeyKey, p.APIKey, &cfg.APIKey},
+		{siteIDKey, p.SiteId, &cfg.SiteID},
+		{baseURLKey, p.BaseUrl, &cfg.BaseURL},
+	} {
+		value, err := resolve(v.key, v.field, prefix, readFile, configFile.Value)
+		if err != nil {
+			return Config{}, err
+		}
+		if value.Value == "" && (v.key != apiKeyKey || p.Credentials == nil) {
+			missing = append(missing, fmt.Sprintf("%s is required (set %s field, %s%s or %s%s_FILE env var, or %s in a config file)",
+				v.key.label, v.key.field, prefix, strings.ToUpper(v.key.name), prefix, strings.ToUpper(v.key.name), v.key.name))
+		}
+		*v.dest = value
+	}
+
+	if len(missing) > 0 {
+		return cfg, errors.New(strings.Join(missing, "; "))
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration without contacting the controller:
+// it loads the configuration, parses the base URL, reads the CA file, if
+// one is set, and checks that the TLS options are not combined with a
+// custom transport other than *http.Transport. See Check for verifying
+// access to the controller.
+func (p *Provider) Validate() error {
+	cfg, err := p.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if _, err := unifi.NormalizeBaseURL(cfg.BaseURL.Value); err != nil {
+		return err
+	}
+	if _, err := p.tlsConfig(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// resolve looks up a single value in all sources, calling readFile only if
+// no other source sets it.
+func resolve(key configKey, field, prefix string, readFile func() (map[string]string, error), path string) (ConfigValue, error) {
+	if field != "" {
+		return ConfigValue{Value: field, Source: SourceField, Origin: key.field}, nil
+	}
+
+	env := prefix + strings.ToUpper(key.name)
+	value, direct := os.LookupEnv(env)
+	secret, indirect := os.LookupEnv(env + "_FILE")
+	switch {
+	case direct && indirect && value != "" && secret != "":
+		return ConfigValue{}, fmt.Errorf("both %s and %s_FILE are set", env, env)
+	case direct && value != "":
+		return ConfigValue{Value: value, Source: SourceEnv, Origin: env}, nil
+	case indirect && secret != "":
+		data, err := os.ReadFile(secret)
+		if err != nil {
+			return ConfigValue{}, fmt.Errorf("failed to read %s from %s_FILE: %w", key.label, env, err)
+		}
+		return ConfigValue{Value: strings.TrimSpace(string(data)), Source: SourceEnvFile, Origin: secret}, nil
+	}
+
+	file, err := readFile()
+	if err != nil {
+		return ConfigValue{}, err
+	}
+	if value := file[key.name]; value != "" {
+		return ConfigValue{Value: value, Source: SourceFile, Origin: path}, nil
+	}
+
+	return ConfigValue{}, nil
+}
+
+// readConfigFile reads the string values of a JSON object (.json) or of
+// "key: value" (.yaml, .yml) or key = "value" (.toml) lines.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		var raw map[string]any
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		values := make(map[string]string, len(raw))
+		for key, value := range raw {
+			if s, ok := value.(string); ok {
+				values[key] = s
+			}
+		}
+		return values, nil
+	case ".yaml", ".yml":
+		return parseKeyValueLines(string(data), ":")
+	case ".toml":
+		return parseKeyValueLines(string(data), "=")
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (want .json, .yaml, .yml or .toml)", ext)
+	}
+}
+
+// parseKeyValueLines parses one "key<sep> value" pair per line, with sep ":"
+// or "=". It is not a YAML or TOML parser: it accepts only the subset of
+// both where every line is a pair, a comment or blank, and rejects anything
+// else instead of guessing. Values may be double or single quoted; with sep
+// "=" they must be, as in TOML. Comments start with '#'.
+func parseKeyValueLines(data, sep string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || (sep == ":" && line == "---") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, sep)
+		if !ok || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "-") {
+			return nil, fmt.Errorf("line %d: expected key%s value", i+1, sep)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		if !validKey(key) {
+			return nil, fmt.Errorf("line %d: invalid key %q", i+1, key)
+		}
+		value = strings.TrimSpace(value)
+
+		var rest string
+		switch {
+		case strings.HasPrefix(value, `"`):
+			end := closingQuote(value)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated string", i+1)
+			}
+			unquoted, err := strconv.Unquote(value[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			value, rest = unquoted, value[end+1:]
+		case strings.HasPrefix(value, "'"):
+			end := strings.IndexByte(value[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated string", i+1)
+			}
+			value, rest = value[1:end+1], value[end+2:]
+		case value == "":
+			return nil, fmt.Errorf("line %d: nested values are not supported", i+1)
+		case sep == "=":
+			return nil, fmt.Errorf("line %d: value of %s must be a quoted string", i+1, key)
+		case strings.ContainsAny(value[:1], "|>{[&*!%@`"):
+			return nil, fmt.Errorf("line %d: only plain or quoted values are supported", i+1)
+		default:
+			if hash := strings.Index(value, " #"); hash >= 0 {
+				value = strings.TrimSpace(value[:hash])
+			}
+		}
+
+		if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("line %d: unexpected %q after value", i+1, rest)
+		}
+		values[key] = value
+	}
+
+	return values, nil
+}
+
+// validKey reports whether key is a bare key of letters, digits, '_' and '-'.
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// closingQuote returns the index of the double quote closing the string
+// starting at s[0], skipping escaped quotes, or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
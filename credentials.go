@@ -0,0 +1,44 @@
+package unifi
+
+import (
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// Credentials supplies the API key before every request.
+type Credentials = unifi.Credentials
+
+// Refresher is implemented by Credentials that can reload the key after
+// the controller rejects it; the request is then retried once.
+type Refresher = unifi.Refresher
+
+// StaticCredentials is a fixed API key.
+type StaticCredentials = unifi.StaticCredentials
+
+// EnvCredentials reads the API key from an environment variable on every request.
+type EnvCredentials = unifi.EnvCredentials
+
+// CredentialsFunc adapts a function, e.g. one reading a secret manager,
+// to the Credentials interface.
+type CredentialsFunc = unifi.CredentialsFunc
+
+// FileCredentials reads the API key from a file and rereads it when the
+// file changes.
+type FileCredentials = unifi.FileCredentials
+
+// NewFileCredentials returns credentials read from the file at path.
+func NewFileCredentials(path string) *FileCredentials {
+	return unifi.NewFileCredentials(path)
+}
+
+// credentials returns the Credentials to use for the resolved API key, or
+// nil if the key is static.
+func (p *Provider) credentials(key ConfigValue) Credentials {
+	switch {
+	case p.Credentials != nil:
+		return p.Credentials
+	case key.Source == SourceEnvFile:
+		return NewFileCredentials(key.Origin)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,301 @@
+// Package ddns keeps the address records of a host in sync with its current
+// addresses, writing to the DNS provider only when they change.
+package ddns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// Default intervals used when the corresponding Updater fields are zero.
+const (
+	DefaultInterval      = 5 * time.Minute
+	DefaultRetryInterval = 30 * time.Second
+)
+
+// Provider is the set of libdns interfaces the updater needs.
+type Provider interface {
+	libdns.RecordSetter
+	libdns.RecordDeleter
+}
+
+// Updater publishes the addresses reported by Source as A/AAAA records.
+type Updater struct {
+	// Provider manages the records.
+	Provider Provider
+
+	// Zone and Name identify the record to keep up to date.
+	Zone string
+	Name string
+
+	// TTL of the published records.
+	TTL time.Duration
+
+	// Source reports the current addresses.
+	Source AddressSource
+
+	// Interval between checks. Defaults to DefaultInterval.
+	Interval time.Duration
+
+	// Jitter is the maximum random delay added to each interval, so that
+	// many hosts sharing a controller do not update in lockstep.
+	Jitter time.Duration
+
+	// RetryInterval is the first delay after a failed update. It doubles
+	// with every consecutive failure, up to Interval.
+	// Defaults to DefaultRetryInterval.
+	RetryInterval time.Duration
+
+	// StateFile persists the last published addresses, so that restarts
+	// do not cause redundant API writes. Optional.
+	StateFile string
+
+	// Logger receives progress messages. Defaults to the standard logger.
+	Logger *log.Logger
+
+	mu     sync.Mutex
+	state  *state
+	random *rand.Rand
+}
+
+// state is the content of the state file.
+type state struct {
+	Zone      string       `json:"zone"`
+	Name      string       `json:"name"`
+	Addresses []netip.Addr `json:"addresses"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// Update publishes the current addresses if they differ from the last
+// published ones. It reports whether the records were changed.
+func (u *Updater) Update(ctx context.Context) (bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	addrs, err := u.Source.Addresses(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to detect addresses: %w", err)
+	}
+	if len(addrs) == 0 {
+		return false, errors.New("no addresses detected")
+	}
+	addrs = normalize(addrs)
+
+	prev, err := u.loadState()
+	if err != nil {
+		return false, err
+	}
+	if prev != nil && prev.Zone == u.Zone && prev.Name == u.Name && equal(prev.Addresses, addrs) {
+		return false, nil
+	}
+
+	var records []libdns.Record
+	for _, addr := range addrs {
+		records = append(records, libdns.Address{
+			Name: u.Name,
+			TTL:  u.TTL,
+			IP:   addr,
+		})
+	}
+
+	if _, err := u.Provider.SetRecords(ctx, u.Zone, records); err != nil {
+		return false, fmt.Errorf("failed to set records: %w", err)
+	}
+
+	// SetRecords leaves other types alone, so drop the records of an
+	// address family that is no longer present
+	if prev != nil && prev.Zone == u.Zone && prev.Name == u.Name {
+		var stale []libdns.Record
+		for _, addr := range prev.Addresses {
+			if !hasFamily(addrs, addr) {
+				stale = append(stale, libdns.Address{Name: u.Name, IP: addr})
+			}
+		}
+		if len(stale) > 0 {
+			if _, err := u.Provider.DeleteRecords(ctx, u.Zone, stale); err != nil {
+				return false, fmt.Errorf("failed to delete stale records: %w", err)
+			}
+		}
+	}
+
+	next := &state{
+		Zone:      u.Zone,
+		Name:      u.Name,
+		Addresses: addrs,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := u.saveState(next); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// Run calls Update every Interval (plus jitter) until ctx is done.
+// Failed updates are retried with exponential backoff.
+func (u *Updater) Run(ctx context.Context) error {
+	interval := u.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	retry := u.RetryInterval
+	if retry <= 0 {
+		retry = DefaultRetryInterval
+	}
+
+	backoff := retry
+	for {
+		var delay time.Duration
+
+		changed, err := u.Update(ctx)
+		switch {
+		case err != nil:
+			u.logf("update of %s failed, retrying in %s: %v", libdns.AbsoluteName(u.Name, u.Zone), backoff, err)
+			delay = backoff
+			backoff *= 2
+			if backoff > interval {
+				backoff = interval
+			}
+		case changed:
+			u.logf("updated %s", libdns.AbsoluteName(u.Name, u.Zone))
+			fallthrough
+		default:
+			delay = interval + u.jitter()
+			backoff = retry
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// jitter returns a random duration in [0, Jitter).
+func (u *Updater) jitter() time.Duration {
+	if u.Jitter <= 0 {
+		return 0
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.random == nil {
+		u.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return time.Duration(u.random.Int63n(int64(u.Jitter)))
+}
+
+// loadState returns the last published state, reading the state file once.
+func (u *Updater) loadState() (*state, error) {
+	if u.state != nil || u.StateFile == "" {
+		return u.state, nil
+	}
+
+	data, err := os.ReadFile(u.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	u.state = &s
+
+	return u.state, nil
+}
+
+// saveState remembers s and writes it to the state file atomically.
+func (u *Updater) saveState(s *state) error {
+	u.state = s
+	if u.StateFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(u.StateFile), ".ddns-state-*")
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), u.StateFile); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return nil
+}
+
+func (u *Updater) logf(format string, args ...any) {
+	if u.Logger != nil {
+		u.Logger.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// normalize sorts addrs and removes duplicates.
+func normalize(addrs []netip.Addr) []netip.Addr {
+	sorted := append([]netip.Addr(nil), addrs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Less(sorted[j]) })
+
+	unique := sorted[:0]
+	for i, addr := range sorted {
+		if i == 0 || addr != sorted[i-1] {
+			unique = append(unique, addr)
+		}
+	}
+	return unique
+}
+
+func equal(a, b []netip.Addr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hasFamily reports whether addrs contains an address of the same family as addr.
+func hasFamily(addrs []netip.Addr, addr netip.Addr) bool {
+	for _, a := range addrs {
+		if a.Is4() == addr.Is4() {
+			return true
+		}
+	}
+	return false
+}
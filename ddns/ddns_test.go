@@ -0,0 +1,167 @@
+package ddns_test
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/libdns/unifi"
+	"github.com/libdns/unifi/ddns"
+	"github.com/libdns/unifi/internal/unifitest"
+)
+
+// staticSource reports a fixed list of addresses
+type staticSource []netip.Addr
+
+func (s *staticSource) Addresses(ctx context.Context) ([]netip.Addr, error) {
+	return *s, nil
+}
+
+func addrs(s ...string) staticSource {
+	var out staticSource
+	for _, a := range s {
+		out = append(out, netip.MustParseAddr(a))
+	}
+	return out
+}
+
+// published returns the sorted addresses of all policies on the fake server
+func published(fake *unifitest.Server) []string {
+	var out []string
+	for _, p := range fake.Policies() {
+		out = append(out, p.IPv4Address+p.IPv6Address)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// newFake starts a fake controller that is closed when the test ends
+func newFake(t *testing.T) *unifitest.Server {
+	t.Helper()
+
+	fake := unifitest.NewServer()
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func newUpdater(t *testing.T, fake *unifitest.Server, source ddns.AddressSource, stateFile string) *ddns.Updater {
+	t.Helper()
+
+	return &ddns.Updater{
+		Provider: &unifi.Provider{
+			APIKey:  fake.APIKey,
+			SiteId:  fake.SiteID,
+			BaseUrl: fake.BaseURL(),
+		},
+		Zone:      "example.com",
+		Name:      "host",
+		TTL:       5 * time.Minute,
+		Source:    source,
+		StateFile: stateFile,
+	}
+}
+
+// TestUpdateOnlyOnChange tests that the API is only written to when addresses change
+func TestUpdateOnlyOnChange(t *testing.T) {
+	fake := newFake(t)
+	ctx := context.Background()
+	source := addrs("192.0.2.1", "2001:db8::1")
+	u := newUpdater(t, fake, &source, "")
+
+	changed, err := u.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if !changed {
+		t.Error("Expected first update to change records")
+	}
+	if got, want := published(fake), []string{"192.0.2.1", "2001:db8::1"}; !equalStrings(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	requests := fake.Requests()
+	changed, err = u.Update(ctx)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if changed || fake.Requests() != requests {
+		t.Error("Expected unchanged addresses to cause no API calls")
+	}
+
+	// The IPv6 address goes away and the IPv4 address changes
+	source = addrs("192.0.2.2")
+	if _, err := u.Update(ctx); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if got, want := published(fake), []string{"192.0.2.2"}; !equalStrings(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+// TestStateFile tests that a new updater does not rewrite records published by a previous one
+func TestStateFile(t *testing.T) {
+	fake := newFake(t)
+	ctx := context.Background()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	source := addrs("192.0.2.1")
+
+	if _, err := newUpdater(t, fake, &source, stateFile).Update(ctx); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := os.Stat(stateFile); err != nil {
+		t.Fatalf("Expected state file to be written: %v", err)
+	}
+
+	requests := fake.Requests()
+	changed, err := newUpdater(t, fake, &source, stateFile).Update(ctx)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if changed || fake.Requests() != requests {
+		t.Error("Expected restarted updater to skip the unchanged addresses")
+	}
+}
+
+// TestFileSource tests reading addresses from a file
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "addrs")
+	content := "# current addresses\n192.0.2.1, 2001:db8::1\n::ffff:192.0.2.2\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ddns.FileSource{Path: path}.Addresses(context.Background())
+	if err != nil {
+		t.Fatalf("Addresses failed: %v", err)
+	}
+
+	want := []netip.Addr{
+		netip.MustParseAddr("192.0.2.1"),
+		netip.MustParseAddr("2001:db8::1"),
+		netip.MustParseAddr("192.0.2.2"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
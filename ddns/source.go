@@ -0,0 +1,131 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// AddressSource reports the current addresses of the local host.
+type AddressSource interface {
+	Addresses(ctx context.Context) ([]netip.Addr, error)
+}
+
+// InterfaceSource reads the global unicast addresses of local network interfaces.
+type InterfaceSource struct {
+	// Interface is the name of the interface to read. If empty, all
+	// interfaces that are up (except loopback ones) are used.
+	Interface string
+}
+
+// Addresses returns the usable addresses of the configured interfaces.
+// Loopback and link-local addresses are skipped.
+func (s InterfaceSource) Addresses(ctx context.Context) ([]netip.Addr, error) {
+	var ifaces []net.Interface
+	if s.Interface != "" {
+		iface, err := net.InterfaceByName(s.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find interface: %w", err)
+		}
+		ifaces = []net.Interface{*iface}
+	} else {
+		all, err := net.Interfaces()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list interfaces: %w", err)
+		}
+		for _, iface := range all {
+			if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagLoopback == 0 {
+				ifaces = append(ifaces, iface)
+			}
+		}
+	}
+
+	var addrs []netip.Addr
+	for _, iface := range ifaces {
+		ifaddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read addresses of %s: %w", iface.Name, err)
+		}
+		for _, ifaddr := range ifaddrs {
+			ipnet, ok := ifaddr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			addr, ok := netip.AddrFromSlice(ipnet.IP)
+			if !ok {
+				continue
+			}
+			addr = addr.Unmap()
+			if addr.IsGlobalUnicast() {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+
+	return addrs, nil
+}
+
+// CommandSource runs a command and parses the addresses it prints,
+// separated by whitespace or commas.
+type CommandSource struct {
+	Command string
+	Args    []string
+}
+
+// Addresses runs the command and returns the addresses from its output.
+func (s CommandSource) Addresses(ctx context.Context) ([]netip.Addr, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Command, s.Args...)
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w: %s", s.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseAddresses(string(out))
+}
+
+// FileSource reads addresses from a file, separated by whitespace or commas.
+// Lines starting with '#' are ignored.
+type FileSource struct {
+	Path string
+}
+
+// Addresses returns the addresses listed in the file.
+func (s FileSource) Addresses(ctx context.Context) ([]netip.Addr, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read address file: %w", err)
+	}
+
+	return parseAddresses(string(data))
+}
+
+// parseAddresses parses whitespace or comma separated addresses.
+func parseAddresses(s string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})
+		for _, field := range fields {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", field, err)
+			}
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+
+	return addrs, nil
+}
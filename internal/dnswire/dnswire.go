@@ -0,0 +1,587 @@
+// Package dnswire implements the small subset of the DNS wire format
+// (RFC 1035) needed to query a resolver and read the answers: packing and
+// unpacking messages with questions and resource records of the types
+// UniFi DNS policies serve, and exchanging them over UDP and TCP.
+package dnswire
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resource record types.
+const (
+	TypeA     uint16 = 1
+	TypeCNAME uint16 = 5
+	TypeMX    uint16 = 15
+	TypeTXT   uint16 = 16
+	TypeAAAA  uint16 = 28
+	TypeSRV   uint16 = 33
+)
+
+// ClassINET is the Internet class.
+const ClassINET uint16 = 1
+
+// Response codes.
+const (
+	RCodeSuccess       uint8 = 0
+	RCodeServerFailure uint8 = 2
+	RCodeNameError     uint8 = 3
+)
+
+// headerLen is the length of the fixed message header.
+const headerLen = 12
+
+// maxUDPSize is the size of the buffer responses are read into.
+const maxUDPSize = 65535
+
+// Header is the fixed header of a message.
+type Header struct {
+	ID                 uint16
+	Response           bool
+	Opcode             uint8
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	RCode              uint8
+}
+
+// Question is an entry of the question section.
+type Question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// RR is a resource record. Names are absolute, with a trailing dot.
+type RR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+
+	// Data is the raw RDATA.
+	Data []byte
+
+	// Text holds the character strings of a TXT record.
+	Text []string
+
+	// Addr is the address of an A or AAAA record.
+	Addr netip.Addr
+
+	// Target is the absolute target name of a CNAME, MX or SRV record.
+	Target string
+
+	// Preference of an MX record.
+	Preference uint16
+
+	// Priority, Weight and Port of an SRV record.
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+}
+
+// String returns the type and data of rr in presentation format.
+func (rr RR) String() string {
+	switch rr.Type {
+	case TypeA:
+		return "A " + rr.Addr.String()
+	case TypeAAAA:
+		return "AAAA " + rr.Addr.String()
+	case TypeCNAME:
+		return "CNAME " + rr.Target
+	case TypeTXT:
+		quoted := make([]string, len(rr.Text))
+		for i, s := range rr.Text {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "TXT " + strings.Join(quoted, " ")
+	case TypeMX:
+		return fmt.Sprintf("MX %d %s", rr.Preference, rr.Target)
+	case TypeSRV:
+		return fmt.Sprintf("SRV %d %d %d %s", rr.Priority, rr.Weight, rr.Port, rr.Target)
+	default:
+		return fmt.Sprintf("TYPE%d", rr.Type)
+	}
+}
+
+// Message is a DNS message. Authority and additional records are skipped
+// when unpacking and never packed.
+type Message struct {
+	Header
+	Questions []Question
+	Answers   []RR
+}
+
+// NewQuery returns a recursive query for the records of type qtype at name,
+// with a random ID.
+func NewQuery(name string, qtype uint16) Message {
+	var id [2]byte
+	_, _ = rand.Read(id[:])
+
+	return Message{
+		Header: Header{
+			ID:               binary.BigEndian.Uint16(id[:]),
+			RecursionDesired: true,
+		},
+		Questions: []Question{{Name: name, Type: qtype, Class: ClassINET}},
+	}
+}
+
+// NewTXT returns a TXT record with the given character strings.
+func NewTXT(name string, ttl uint32, text ...string) (RR, error) {
+	var data []byte
+	for _, s := range text {
+		if len(s) > 255 {
+			return RR{}, fmt.Errorf("TXT string of %d bytes exceeds 255 bytes", len(s))
+		}
+		data = append(data, byte(len(s)))
+		data = append(data, s...)
+	}
+	return RR{Name: Fqdn(name), Type: TypeTXT, Class: ClassINET, TTL: ttl, Data: data, Text: text}, nil
+}
+
+// NewAddress returns an A or AAAA record, depending on the address family.
+func NewAddress(name string, ttl uint32, addr netip.Addr) RR {
+	rr := RR{Name: Fqdn(name), Type: TypeA, Class: ClassINET, TTL: ttl, Addr: addr}
+	if addr.Is6() && !addr.Is4In6() {
+		rr.Type = TypeAAAA
+		b := addr.As16()
+		rr.Data = b[:]
+	} else {
+		b := addr.Unmap().As4()
+		rr.Data = b[:]
+	}
+	return rr
+}
+
+// NewCNAME returns a CNAME record.
+func NewCNAME(name string, ttl uint32, target string) (RR, error) {
+	data, err := appendName(nil, target)
+	if err != nil {
+		return RR{}, err
+	}
+	return RR{Name: Fqdn(name), Type: TypeCNAME, Class: ClassINET, TTL: ttl, Data: data, Target: Fqdn(target)}, nil
+}
+
+// NewMX returns an MX record.
+func NewMX(name string, ttl uint32, preference uint16, target string) (RR, error) {
+	data, err := appendName(appendUint16(nil, preference), target)
+	if err != nil {
+		return RR{}, err
+	}
+	return RR{Name: Fqdn(name), Type: TypeMX, Class: ClassINET, TTL: ttl, Data: data, Preference: preference, Target: Fqdn(target)}, nil
+}
+
+// NewSRV returns an SRV record.
+func NewSRV(name string, ttl uint32, priority, weight, port uint16, target string) (RR, error) {
+	data := appendUint16(appendUint16(appendUint16(nil, priority), weight), port)
+	data, err := appendName(data, target)
+	if err != nil {
+		return RR{}, err
+	}
+	return RR{
+		Name: Fqdn(name), Type: TypeSRV, Class: ClassINET, TTL: ttl, Data: data,
+		Priority: priority, Weight: weight, Port: port, Target: Fqdn(target),
+	}, nil
+}
+
+// Fqdn returns name with a trailing dot.
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// Pack encodes m. Names are not compressed.
+func (m Message) Pack() ([]byte, error) {
+	var flags uint16
+	if m.Response {
+		flags |= 1 << 15
+	}
+	flags |= uint16(m.Opcode&0xf) << 11
+	if m.Authoritative {
+		flags |= 1 << 10
+	}
+	if m.Truncated {
+		flags |= 1 << 9
+	}
+	if m.RecursionDesired {
+		flags |= 1 << 8
+	}
+	if m.RecursionAvailable {
+		flags |= 1 << 7
+	}
+	flags |= uint16(m.RCode & 0xf)
+
+	b := make([]byte, headerLen, 512)
+	binary.BigEndian.PutUint16(b[0:], m.ID)
+	binary.BigEndian.PutUint16(b[2:], flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+
+	var err error
+	for _, q := range m.Questions {
+		if b, err = appendName(b, q.Name); err != nil {
+			return nil, err
+		}
+		b = appendUint16(b, q.Type)
+		b = appendUint16(b, q.Class)
+	}
+	for _, rr := range m.Answers {
+		if b, err = appendName(b, rr.Name); err != nil {
+			return nil, err
+		}
+		if len(rr.Data) > 0xffff {
+			return nil, fmt.Errorf("record data of %d bytes is too long", len(rr.Data))
+		}
+		b = appendUint16(b, rr.Type)
+		b = appendUint16(b, rr.Class)
+		b = appendUint32(b, rr.TTL)
+		b = appendUint16(b, uint16(len(rr.Data)))
+		b = append(b, rr.Data...)
+	}
+	return b, nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// appendName appends name in uncompressed wire format.
+func appendName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return append(b, 0), nil
+	}
+	if len(name)+2 > 255 {
+		return nil, fmt.Errorf("name %q is too long", name)
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid label %q in name %q", label, name)
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0), nil
+}
+
+// errTruncated is returned when a message ends unexpectedly.
+var errTruncated = errors.New("message truncated")
+
+// Unpack decodes a message.
+func Unpack(b []byte) (Message, error) {
+	if len(b) < headerLen {
+		return Message{}, errTruncated
+	}
+
+	flags := binary.BigEndian.Uint16(b[2:])
+	m := Message{Header: Header{
+		ID:                 binary.BigEndian.Uint16(b[0:]),
+		Response:           flags&(1<<15) != 0,
+		Opcode:             uint8(flags>>11) & 0xf,
+		Authoritative:      flags&(1<<10) != 0,
+		Truncated:          flags&(1<<9) != 0,
+		RecursionDesired:   flags&(1<<8) != 0,
+		RecursionAvailable: flags&(1<<7) != 0,
+		RCode:              uint8(flags & 0xf),
+	}}
+	qdcount := int(binary.BigEndian.Uint16(b[4:]))
+	ancount := int(binary.BigEndian.Uint16(b[6:]))
+
+	off := headerLen
+	for i := 0; i < qdcount; i++ {
+		name, n, err := readName(b, off)
+		if err != nil {
+			return Message{}, err
+		}
+		off = n
+		if off+4 > len(b) {
+			return Message{}, errTruncated
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[off:]),
+			Class: binary.BigEndian.Uint16(b[off+2:]),
+		})
+		off += 4
+	}
+
+	for i := 0; i < ancount; i++ {
+		rr, n, err := readRR(b, off)
+		if err != nil {
+			return Message{}, err
+		}
+		m.Answers = append(m.Answers, rr)
+		off = n
+	}
+
+	return m, nil
+}
+
+// readRR reads the resource record at off and returns the offset after it.
+func readRR(b []byte, off int) (RR, int, error) {
+	name, off, err := readName(b, off)
+	if err != nil {
+		return RR{}, 0, err
+	}
+	if off+10 > len(b) {
+		return RR{}, 0, errTruncated
+	}
+
+	rr := RR{
+		Name:  name,
+		Type:  binary.BigEndian.Uint16(b[off:]),
+		Class: binary.BigEndian.Uint16(b[off+2:]),
+		TTL:   binary.BigEndian.Uint32(b[off+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(b[off+8:]))
+	off += 10
+	if off+length > len(b) {
+		return RR{}, 0, errTruncated
+	}
+	rr.Data = b[off : off+length]
+
+	if err := decodeData(&rr, b, off); err != nil {
+		return RR{}, 0, fmt.Errorf("invalid %s record %s: %w", typeName(rr.Type), rr.Name, err)
+	}
+	return rr, off + length, nil
+}
+
+// decodeData fills the typed fields of rr from its data, which starts at
+// off in the message b. Names in the data may point into b.
+func decodeData(rr *RR, b []byte, off int) error {
+	var err error
+	data := rr.Data
+
+	switch rr.Type {
+	case TypeA, TypeAAAA:
+		addr, ok := netip.AddrFromSlice(data)
+		if !ok || (rr.Type == TypeA) != (len(data) == 4) {
+			return fmt.Errorf("address of %d bytes", len(data))
+		}
+		rr.Addr = addr
+	case TypeCNAME:
+		rr.Target, _, err = readName(b, off)
+	case TypeTXT:
+		rr.Text, err = readStrings(data)
+	case TypeMX:
+		if len(data) < 3 {
+			return errTruncated
+		}
+		rr.Preference = binary.BigEndian.Uint16(data)
+		rr.Target, _, err = readName(b, off+2)
+	case TypeSRV:
+		if len(data) < 7 {
+			return errTruncated
+		}
+		rr.Priority = binary.BigEndian.Uint16(data)
+		rr.Weight = binary.BigEndian.Uint16(data[2:])
+		rr.Port = binary.BigEndian.Uint16(data[4:])
+		rr.Target, _, err = readName(b, off+6)
+	}
+	return err
+}
+
+// typeName returns the mnemonic of a record type.
+func typeName(t uint16) string {
+	return strings.Fields(RR{Type: t}.String())[0]
+}
+
+// readStrings reads the character strings of TXT record data.
+func readStrings(data []byte) ([]string, error) {
+	var text []string
+	for off := 0; off < len(data); {
+		n := int(data[off])
+		if off+1+n > len(data) {
+			return nil, errTruncated
+		}
+		text = append(text, string(data[off+1:off+1+n]))
+		off += 1 + n
+	}
+	return text, nil
+}
+
+// readName reads the possibly compressed name at off and returns it with
+// a trailing dot, along with the offset after it.
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return "", 0, errTruncated
+		}
+
+		n := int(b[off])
+		switch n & 0xc0 {
+		case 0x00:
+			if n == 0 {
+				if end < 0 {
+					end = off + 1
+				}
+				return strings.Join(labels, ".") + ".", end, nil
+			}
+			if off+1+n > len(b) {
+				return "", 0, errTruncated
+			}
+			labels = append(labels, string(b[off+1:off+1+n]))
+			off += 1 + n
+		case 0xc0:
+			if off+2 > len(b) {
+				return "", 0, errTruncated
+			}
+			if jumps++; jumps > 32 {
+				return "", 0, errors.New("too many compression pointers")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+		default:
+			return "", 0, fmt.Errorf("unsupported label type %#x", n&0xc0)
+		}
+	}
+}
+
+// Exchange sends q to the resolver at addr over UDP and returns its
+// response, repeating the query over TCP if the response was truncated.
+// The context bounds the whole exchange.
+func Exchange(ctx context.Context, addr string, q Message) (Message, error) {
+	resp, err := exchangeUDP(ctx, addr, q)
+	if err != nil || !resp.Truncated {
+		return resp, err
+	}
+	return ExchangeTCP(ctx, addr, q)
+}
+
+// exchangeUDP sends q over UDP. Responses with a different ID are ignored.
+func exchangeUDP(ctx context.Context, addr string, q Message) (Message, error) {
+	query, err := q.Pack()
+	if err != nil {
+		return Message{}, err
+	}
+
+	conn, err := dial(ctx, "udp", addr)
+	if err != nil {
+		return Message{}, err
+	}
+	defer conn.Close()
+	defer watch(ctx, conn)()
+
+	if _, err := conn.Write(query); err != nil {
+		return Message{}, fmt.Errorf("failed to send query: %w", err)
+	}
+
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return Message{}, readError(ctx, err)
+		}
+
+		resp, err := Unpack(buf[:n])
+		if err != nil || !resp.Response || resp.ID != q.ID {
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// ExchangeTCP sends q to the resolver at addr over TCP and returns its response.
+func ExchangeTCP(ctx context.Context, addr string, q Message) (Message, error) {
+	query, err := q.Pack()
+	if err != nil {
+		return Message{}, err
+	}
+	if len(query) > 0xffff {
+		return Message{}, fmt.Errorf("query of %d bytes is too long", len(query))
+	}
+
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return Message{}, err
+	}
+	defer conn.Close()
+	defer watch(ctx, conn)()
+
+	if _, err := conn.Write(append(appendUint16(nil, uint16(len(query))), query...)); err != nil {
+		return Message{}, fmt.Errorf("failed to send query: %w", err)
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return Message{}, readError(ctx, err)
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return Message{}, readError(ctx, err)
+	}
+
+	resp, err := Unpack(buf)
+	if err != nil {
+		return Message{}, fmt.Errorf("invalid response: %w", err)
+	}
+	if !resp.Response || resp.ID != q.ID {
+		return Message{}, errors.New("response does not match the query")
+	}
+	return resp, nil
+}
+
+// HostPort adds the DNS port 53 to addr if it has no port.
+func HostPort(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), "53")
+}
+
+func dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to resolver: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// watch interrupts I/O on conn when ctx is done, until the returned
+// function is called.
+func watch(ctx context.Context, conn net.Conn) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// readError returns the context's error if it caused err.
+func readError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("failed to read response: %w", err)
+}
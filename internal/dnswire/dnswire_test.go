@@ -0,0 +1,102 @@
+package dnswire
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestPackUnpack(t *testing.T) {
+	txt, err := NewTXT("_acme-challenge.example.com", 60, "first", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cname, err := NewCNAME("alias.example.com", 60, "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mx, err := NewMX("example.com", 60, 0, "mail.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := NewSRV("_sip._tcp.example.com", 60, 1, 2, 5060, "sip.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := Message{
+		Header: Header{
+			ID:                 0xbeef,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   true,
+			RecursionAvailable: true,
+			RCode:              RCodeSuccess,
+		},
+		Questions: []Question{{Name: "_acme-challenge.example.com.", Type: TypeTXT, Class: ClassINET}},
+		Answers: []RR{
+			txt,
+			NewAddress("www.example.com", 300, netip.MustParseAddr("192.0.2.1")),
+			NewAddress("www.example.com", 300, netip.MustParseAddr("2001:db8::1")),
+			cname,
+			mx,
+			srv,
+		},
+	}
+
+	packed, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("Pack failed: %v", err)
+	}
+	got, err := Unpack(packed)
+	if err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, msg) {
+		t.Errorf("Round trip changed the message:\n got %+v\nwant %+v", got, msg)
+	}
+}
+
+func TestUnpackCompressedName(t *testing.T) {
+	// Response for example.com TXT whose answer name points to the question
+	packed := []byte{
+		0x12, 0x34, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0,
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 16, 0, 1,
+		0xc0, 12, 0, 16, 0, 1, 0, 0, 0, 60, 0, 3, 2, 'h', 'i',
+	}
+
+	msg, err := Unpack(packed)
+	if err != nil {
+		t.Fatalf("Unpack failed: %v", err)
+	}
+	if len(msg.Answers) != 1 || msg.Answers[0].Name != "example.com." || !reflect.DeepEqual(msg.Answers[0].Text, []string{"hi"}) {
+		t.Errorf("Unexpected answers: %+v", msg.Answers)
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	tests := map[string][]byte{
+		"short header":   {0, 1, 2},
+		"truncated name": {0, 1, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0, 7, 'e', 'x'},
+		"pointer loop":   {0, 1, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0, 12, 0, 16, 0, 1},
+	}
+	for name, packed := range tests {
+		if _, err := Unpack(packed); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	mx, _ := NewMX("example.com", 60, 10, "mail.example.com")
+	txt, _ := NewTXT("example.com", 60, "a", "b c")
+
+	for rr, want := range map[*RR]string{
+		&mx:  "MX 10 mail.example.com.",
+		&txt: `TXT "a" "b c"`,
+	} {
+		if got := rr.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
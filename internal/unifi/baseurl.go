@@ -0,0 +1,165 @@
+package unifi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// IntegrationPaths are the paths of the integration API relative to the
+// controller address, in the order they are probed: UniFi OS consoles serve
+// it behind the /proxy/network prefix, standalone Network applications at
+// the root.
+var IntegrationPaths = []string{
+	"/proxy/network/integration/v1",
+	"/integration/v1",
+}
+
+// standalonePort is the default HTTPS port of a standalone Network application.
+const standalonePort = "8443"
+
+// NormalizeBaseURL validates a base URL and returns it in canonical form.
+// A bare host or IP address is accepted and defaults to https; trailing
+// slashes are removed. A URL without a path is returned without one,
+// and a Client given such a URL, or one whose path does not end in
+// /integration/v1, discovers the integration API path.
+func NormalizeBaseURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("base URL is empty")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %q: %w", raw, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("invalid base URL %q: scheme must be https or http", raw)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid base URL %q: missing host", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid base URL %q: must not contain a query or fragment", raw)
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// BaseURL returns the base URL of the integration API. A URL whose path
+// ends in /integration/v1 is used as given. Otherwise the API is discovered
+// on first use: for a controller address without a path by probing
+// IntegrationPaths, and port 8443 for https addresses without an explicit
+// port; for a partial path such as /proxy/network by probing the path with
+// /integration/v1 appended, then the path as given. The discovered URL is
+// remembered; failures are not. Concurrent first calls may probe in parallel.
+func (c *Client) BaseURL(ctx context.Context) (string, error) {
+	c.baseMu.Lock()
+	discovered := c.discovered
+	c.baseMu.Unlock()
+	if discovered != "" {
+		return discovered, nil
+	}
+
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %q: %w", c.baseURL, err)
+	}
+
+	path := strings.TrimRight(u.Path, "/")
+	base := strings.TrimRight(c.baseURL, "/")
+	if !strings.HasSuffix(path, integrationSuffix) {
+		if base, err = c.discover(ctx, candidates(u, path)); err != nil {
+			return "", err
+		}
+		if c.logger != nil {
+			c.logger.DebugContext(ctx, "discovered unifi integration api", "base_url", base)
+		}
+	}
+
+	c.baseMu.Lock()
+	defer c.baseMu.Unlock()
+	if c.discovered == "" {
+		c.discovered = base
+	}
+	return c.discovered, nil
+}
+
+// integrationSuffix ends the path of every integration API base URL.
+const integrationSuffix = "/integration/v1"
+
+// candidates returns the base URLs to probe for the controller at u, whose
+// path, without trailing slashes, is path.
+func candidates(u *url.URL, path string) []string {
+	origin := u.Scheme + "://" + u.Host
+	if path != "" {
+		return []string{origin + path + integrationSuffix, origin + path}
+	}
+
+	var urls []string
+	for _, p := range IntegrationPaths {
+		urls = append(urls, origin+p)
+	}
+	if u.Scheme == "https" && u.Port() == "" {
+		urls = append(urls, "https://"+net.JoinHostPort(u.Hostname(), standalonePort)+integrationSuffix)
+	}
+	return urls
+}
+
+// discover probes the candidate integration API locations in order and
+// returns the first one that answers like the API. A 401 or 403 also
+// identifies the API, leaving the key problem to be reported by the request
+// that follows.
+func (c *Client) discover(ctx context.Context, candidates []string) (string, error) {
+	var errs []string
+	for _, candidate := range candidates {
+		err := c.probe(ctx, candidate)
+		if err == nil {
+			return candidate, nil
+		}
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+			return candidate, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", candidate, err))
+	}
+
+	return "", fmt.Errorf("no UniFi Network integration API found at %s; set the full base URL, ending in %s, e.g. %s (tried %s)",
+		c.baseURL, integrationSuffix, candidates[0], strings.Join(errs, "; "))
+}
+
+// probe lists the sites at base and checks that the answer is a JSON page.
+func (c *Client) probe(ctx context.Context, base string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/sites?limit=1", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+
+	var page struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(resp, &page); err != nil || page.Data == nil {
+		return errors.New("response is not an integration API page")
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package unifi
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials supplies the API key. The client asks for the key before
+// every request, so a new key takes effect without recreating the client.
+type Credentials interface {
+	APIKey(ctx context.Context) (string, error)
+}
+
+// Refresher is implemented by Credentials that can reload the key. When the
+// controller rejects a key with 401 Unauthorized, the client calls Refresh
+// and, if the key changed, retries the request once.
+type Refresher interface {
+	Refresh(ctx context.Context) error
+}
+
+// WithCredentials makes the client get its API key from creds instead of
+// the key passed to NewClient.
+func WithCredentials(creds Credentials) Option {
+	return func(c *Client) {
+		c.credentials = creds
+	}
+}
+
+// StaticCredentials is a fixed API key.
+type StaticCredentials string
+
+// APIKey returns the key.
+func (s StaticCredentials) APIKey(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// EnvCredentials reads the API key from an environment variable on every request.
+type EnvCredentials struct {
+	Name string
+}
+
+// APIKey returns the value of the variable, or an error if it is empty.
+func (e EnvCredentials) APIKey(ctx context.Context) (string, error) {
+	key := os.Getenv(e.Name)
+	if key == "" {
+		return "", fmt.Errorf("environment variable %s is empty", e.Name)
+	}
+	return key, nil
+}
+
+// CredentialsFunc adapts a function to the Credentials interface.
+type CredentialsFunc func(ctx context.Context) (string, error)
+
+// APIKey calls f.
+func (f CredentialsFunc) APIKey(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// FileCredentials reads the API key from a file, such as a mounted secret,
+// and rereads it whenever the file's modification time or size changes.
+// Surrounding whitespace is trimmed. Use NewFileCredentials to create one.
+type FileCredentials struct {
+	path string
+
+	mu      sync.Mutex
+	key     string
+	modTime time.Time
+	size    int64
+}
+
+// NewFileCredentials returns credentials read from the file at path.
+// The file is first read on use.
+func NewFileCredentials(path string) *FileCredentials {
+	return &FileCredentials{path: path}
+}
+
+// APIKey returns the key from the file, rereading it if it changed.
+func (f *FileCredentials) APIKey(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key: %w", err)
+	}
+	if f.key == "" || !info.ModTime().Equal(f.modTime) || info.Size() != f.size {
+		if err := f.load(info.ModTime(), info.Size()); err != nil {
+			return "", err
+		}
+	}
+	return f.key, nil
+}
+
+// Refresh rereads the file even if it looks unchanged, as a file replaced
+// within the timestamp resolution of the file system may.
+func (f *FileCredentials) Refresh(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read API key: %w", err)
+	}
+	return f.load(info.ModTime(), info.Size())
+}
+
+func (f *FileCredentials) load(modTime time.Time, size int64) error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read API key: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return fmt.Errorf("API key file %s is empty", f.path)
+	}
+
+	f.key, f.modTime, f.size = key, modTime, size
+	return nil
+}
+
+// apiKey returns the key to send with the next request.
+func (c *Client) apiKey(ctx context.Context) (string, error) {
+	if c.credentials == nil {
+		return c.staticKey, nil
+	}
+	key, err := c.credentials.APIKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get API key: %w", err)
+	}
+	return key, nil
+}
+
+// refreshKey refreshes the credentials after key was rejected and returns
+// a different key to retry with, if there is one.
+func (c *Client) refreshKey(ctx context.Context, key string) (string, bool) {
+	if refresher, ok := c.credentials.(Refresher); ok {
+		if err := refresher.Refresh(ctx); err != nil {
+			return "", false
+		}
+	}
+
+	newKey, err := c.apiKey(ctx)
+	if err != nil || newKey == key {
+		return "", false
+	}
+	return newKey, true
+}
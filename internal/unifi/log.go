@@ -0,0 +1,73 @@
+package unifi
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Logger receives debug messages about API requests. It is satisfied by
+// *slog.Logger; args are alternating keys and values.
+type Logger interface {
+	DebugContext(ctx context.Context, msg string, args ...any)
+}
+
+// WithLogger makes the client log every API request at debug level.
+// The API key is never logged.
+func WithLogger(logger Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// observeRequest logs, measures and ends the span of a request after all its attempts.
+func (c *Client) observeRequest(req *http.Request, span Span, status int, start time.Time, retries int, err error) {
+	if status != 0 {
+		span.SetAttributes(Attribute{"http.response.status_code", status})
+	}
+	span.SetAttributes(Attribute{"unifi.retries", retries})
+	EndSpan(span, err)
+
+	if c.metrics != nil {
+		c.metrics.ObserveRequest(req.Method, endpointTemplate(req.URL.Path), status, time.Since(start))
+	}
+	if c.logger == nil {
+		return
+	}
+
+	args := []any{
+		"method", req.Method,
+		"path", redact(req, req.URL.Path),
+		"status", status,
+		"latency", time.Since(start),
+		"retries", retries,
+	}
+	if id := policyID(req.URL.Path); id != "" {
+		args = append(args, "policy_id", id)
+	}
+	if err != nil {
+		args = append(args, "error", redact(req, err.Error()))
+	}
+
+	c.logger.DebugContext(req.Context(), "unifi api request", args...)
+}
+
+// redact removes the API key sent with req from s, should the controller ever echo it.
+func redact(req *http.Request, s string) string {
+	key := req.Header.Get("X-API-KEY")
+	if key == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, key, "[REDACTED]")
+}
+
+// policyID returns the policy ID of a /dns/policies/{id} path, or "".
+func policyID(path string) string {
+	const marker = "/dns/policies/"
+	i := strings.LastIndex(path, marker)
+	if i < 0 {
+		return ""
+	}
+	return strings.Trim(path[i+len(marker):], "/")
+}
@@ -0,0 +1,189 @@
+package unifi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements of API requests and provider operations.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveRequest is called once per API request, after all retries.
+	// The endpoint is the URL path template, e.g. /sites/{siteId}/dns/policies.
+	// The status is 0 if no response was received.
+	ObserveRequest(method, endpoint string, status int, latency time.Duration)
+
+	// ObserveOperation is called once per record of an append, set or
+	// delete operation, and once per get operation with an empty record type.
+	ObserveOperation(operation, recordType string, err error)
+}
+
+// WithMetrics makes the client report every API request to m.
+func WithMetrics(m Metrics) Option {
+	return func(c *Client) {
+		c.metrics = m
+	}
+}
+
+// endpointTemplate replaces the IDs in an API path with placeholders,
+// keeping the path below the base URL only.
+func endpointTemplate(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range parts {
+		if parts[i] == "sites" {
+			parts = parts[i:]
+			break
+		}
+	}
+
+	for i := 1; i < len(parts); i++ {
+		switch parts[i-1] {
+		case "sites":
+			parts[i] = "{siteId}"
+		case "policies":
+			parts[i] = "{policyId}"
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the request
+// latency histogram buckets of PrometheusMetrics.
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// PrometheusMetrics is a Metrics implementation that serves its counters
+// and histograms in the Prometheus text exposition format.
+type PrometheusMetrics struct {
+	mu         sync.Mutex
+	requests   map[string]uint64
+	latencies  map[string]*histogram
+	operations map[string]uint64
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusMetrics returns an empty PrometheusMetrics.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		requests:   make(map[string]uint64),
+		latencies:  make(map[string]*histogram),
+		operations: make(map[string]uint64),
+	}
+}
+
+// ObserveRequest implements Metrics.
+func (m *PrometheusMetrics) ObserveRequest(method, endpoint string, status int, latency time.Duration) {
+	statusLabel := "error"
+	if status != 0 {
+		statusLabel = strconv.Itoa(status)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[labels("method", method, "endpoint", endpoint, "status", statusLabel)]++
+
+	key := labels("method", method, "endpoint", endpoint)
+	h, ok := m.latencies[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(DefaultLatencyBuckets))}
+		m.latencies[key] = h
+	}
+	seconds := latency.Seconds()
+	for i, bound := range DefaultLatencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// ObserveOperation implements Metrics.
+func (m *PrometheusMetrics) ObserveOperation(operation, recordType string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.operations[labels("operation", operation, "type", recordType, "result", result)]++
+}
+
+// ServeHTTP writes all metrics in the Prometheus text exposition format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	fmt.Fprintln(w, "# HELP unifi_api_requests_total Total number of UniFi API requests.")
+	fmt.Fprintln(w, "# TYPE unifi_api_requests_total counter")
+	for _, key := range sortedKeys(m.requests) {
+		fmt.Fprintf(w, "unifi_api_requests_total{%s} %d\n", key, m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP unifi_api_request_duration_seconds Latency of UniFi API requests, including retries.")
+	fmt.Fprintln(w, "# TYPE unifi_api_request_duration_seconds histogram")
+	for _, key := range sortedKeys(m.latencies) {
+		h := m.latencies[key]
+		var cumulative uint64
+		for i, bound := range DefaultLatencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "unifi_api_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", key, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(w, "unifi_api_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", key, h.count)
+		fmt.Fprintf(w, "unifi_api_request_duration_seconds_sum{%s} %s\n", key, formatFloat(h.sum))
+		fmt.Fprintf(w, "unifi_api_request_duration_seconds_count{%s} %d\n", key, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP unifi_record_operations_total Total number of record operations by kind, record type and result.")
+	fmt.Fprintln(w, "# TYPE unifi_record_operations_total counter")
+	for _, key := range sortedKeys(m.operations) {
+		fmt.Fprintf(w, "unifi_record_operations_total{%s} %d\n", key, m.operations[key])
+	}
+}
+
+// labels formats alternating label names and values as name="value" pairs.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,90 @@
+package unifi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policy domains are stored without a trailing dot, while libdns zones
+// usually have one ("example.com."). The functions below accept either
+// form and compare names case-insensitively and on label boundaries.
+
+// PolicyDomain returns the domain of a policy for the record name relative
+// to zone, like libdns.AbsoluteName but without the trailing dot: "@" and
+// "" stand for the zone itself, and a name ending in a dot is taken as
+// already absolute. It returns an error for an absolute name outside the
+// zone.
+func PolicyDomain(name, zone string) (string, error) {
+	zone = strings.TrimSuffix(zone, ".")
+	switch {
+	case name == "" || name == "@":
+		return zone, nil
+	case strings.HasSuffix(name, "."):
+		if zone != "" && !InZone(name, zone) {
+			return "", fmt.Errorf("name %s is not in zone %s", name, zone)
+		}
+		return strings.TrimSuffix(name, "."), nil
+	case zone == "":
+		return name, nil
+	default:
+		return name + "." + zone, nil
+	}
+}
+
+// RelativeName returns the name of domain relative to zone, like
+// libdns.RelativeName: "@" for the zone itself, and the labels before the
+// zone for names below it. Unlike libdns.RelativeName, myexample.com is
+// not below example.com. A domain outside the zone is returned as an
+// absolute name with a trailing dot.
+func RelativeName(domain, zone string) string {
+	domain = strings.TrimSuffix(domain, ".")
+	zone = strings.TrimSuffix(zone, ".")
+	switch {
+	case SameName(domain, zone):
+		return "@"
+	case InZone(domain, zone):
+		return domain[:len(domain)-len(zone)-1]
+	default:
+		return domain + "."
+	}
+}
+
+// SameName reports whether a and b are the same name, ignoring case and
+// trailing dots.
+func SameName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// InZone reports whether domain is zone or a name below it, ignoring case
+// and trailing dots. Names are compared on label boundaries, so
+// myexample.com is not in example.com.
+func InZone(domain, zone string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	return domain == zone || strings.HasSuffix(domain, "."+zone)
+}
+
+// SplitSRVName splits the owner name of an SRV record, such as
+// "_sip._tcp.voip", into its service "sip", transport "tcp" and the rest of
+// the name, "voip", which is empty for "_sip._tcp" at the zone apex. It
+// reports false if name does not start with two underscore labels.
+func SplitSRVName(name string) (service, transport, rest string, ok bool) {
+	labels := strings.SplitN(name, ".", 3)
+	if len(labels) < 2 || len(labels[0]) < 2 || len(labels[1]) < 2 ||
+		labels[0][0] != '_' || labels[1][0] != '_' {
+		return "", "", "", false
+	}
+	if len(labels) == 3 {
+		rest = labels[2]
+	}
+	return labels[0][1:], labels[1][1:], rest, true
+}
+
+// checkWildcard returns an error if name has a wildcard anywhere but as
+// its whole leftmost label, as in "*" or "*.sub".
+func checkWildcard(name string) error {
+	if name != "*" && strings.Contains(strings.TrimPrefix(name, "*."), "*") {
+		return fmt.Errorf("invalid wildcard name %q: the wildcard must be the whole leftmost label", name)
+	}
+	return nil
+}
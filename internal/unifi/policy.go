@@ -0,0 +1,161 @@
+package unifi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// policyFields holds the JSON names of the fields DNSPolicy declares.
+var policyFields = jsonFields(reflect.TypeOf(DNSPolicy{}))
+
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// Clone returns a copy of the policy that shares no pointers or maps with p.
+func (p DNSPolicy) Clone() DNSPolicy {
+	p.TTLSeconds = clonePtr(p.TTLSeconds)
+	p.Priority = clonePtr(p.Priority)
+	p.Port = clonePtr(p.Port)
+	p.Weight = clonePtr(p.Weight)
+	if p.Extra != nil {
+		extra := make(map[string]json.RawMessage, len(p.Extra))
+		for name, value := range p.Extra {
+			extra[name] = append(json.RawMessage(nil), value...)
+		}
+		p.Extra = extra
+	}
+	return p
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	return Ptr(*p)
+}
+
+// MarshalJSON encodes the policy, always including the text of a TXT
+// policy so that empty text is sent rather than omitted. The fields in
+// Extra are added unless the policy declares a field of the same name.
+func (p DNSPolicy) MarshalJSON() ([]byte, error) {
+	type plain DNSPolicy
+
+	var v any = plain(p)
+	if p.Type == RecordTypeTXT {
+		v = struct {
+			plain
+			Text string `json:"text"`
+		}{plain(p), p.Text}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil || len(p.Extra) == 0 {
+		return data, err
+	}
+
+	fields := make(map[string]json.RawMessage, len(p.Extra)+len(policyFields))
+	for name, value := range p.Extra {
+		if !policyFields[name] {
+			fields[name] = value
+		}
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON decodes the policy, keeping the fields DNSPolicy does not
+// declare in Extra.
+func (p *DNSPolicy) UnmarshalJSON(data []byte) error {
+	type plain DNSPolicy
+
+	decoded := plain{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for name, value := range fields {
+		if policyFields[name] {
+			continue
+		}
+		if decoded.Extra == nil {
+			decoded.Extra = make(map[string]json.RawMessage)
+		}
+		decoded.Extra[name] = value
+	}
+
+	*p = DNSPolicy(decoded)
+	return nil
+}
+
+// mergePolicy returns current with the fields set in changes applied:
+// non-empty strings, non-nil numbers, the text of a TXT policy and
+// Enabled. The fields of Extra in changes are added to those of current.
+// If changes has another type, the fields of the old type are dropped and
+// only the ID and Extra of current are kept.
+func mergePolicy(current, changes DNSPolicy) DNSPolicy {
+	merged := current
+	if changes.Type != "" && changes.Type != current.Type {
+		merged = changes
+		merged.ID = current.ID
+	}
+
+	merged.Enabled = changes.Enabled
+	mergeString(&merged.Type, changes.Type)
+	mergeString(&merged.Domain, changes.Domain)
+	mergeString(&merged.IPv4Address, changes.IPv4Address)
+	mergeString(&merged.IPv6Address, changes.IPv6Address)
+	mergeString(&merged.TargetDomain, changes.TargetDomain)
+	mergeString(&merged.MailServerDomain, changes.MailServerDomain)
+	mergeString(&merged.ServerDomain, changes.ServerDomain)
+	mergeString(&merged.Service, changes.Service)
+	mergeString(&merged.Protocol, changes.Protocol)
+	if changes.Type == RecordTypeTXT {
+		merged.Text = changes.Text
+	} else {
+		mergeString(&merged.Text, changes.Text)
+	}
+	mergePtr(&merged.TTLSeconds, changes.TTLSeconds)
+	mergePtr(&merged.Priority, changes.Priority)
+	mergePtr(&merged.Port, changes.Port)
+	mergePtr(&merged.Weight, changes.Weight)
+
+	merged.Extra = nil
+	if len(current.Extra)+len(changes.Extra) > 0 {
+		merged.Extra = make(map[string]json.RawMessage, len(current.Extra)+len(changes.Extra))
+		for name, value := range current.Extra {
+			merged.Extra[name] = value
+		}
+		for name, value := range changes.Extra {
+			merged.Extra[name] = value
+		}
+	}
+
+	return merged
+}
+
+func mergeString(dst *string, s string) {
+	if s != "" {
+		*dst = s
+	}
+}
+
+func mergePtr[T any](dst **T, p *T) {
+	if p != nil {
+		*dst = p
+	}
+}
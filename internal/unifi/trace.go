@@ -0,0 +1,61 @@
+package unifi
+
+import (
+	"context"
+)
+
+// Tracer starts spans. It is a minimal subset of OpenTelemetry's
+// trace.Tracer, so an adapter is a few lines and no tracing library is
+// required by this package.
+type Tracer interface {
+	// Start starts a span as a child of any span in ctx and returns a
+	// context carrying the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key/value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// WithTracer makes the client create a span for every API request.
+func WithTracer(t Tracer) Option {
+	return func(c *Client) {
+		c.tracer = t
+	}
+}
+
+// StartSpan starts a span with t, or returns a no-op span if t is nil.
+func StartSpan(ctx context.Context, t Tracer, name string, attrs ...Attribute) (context.Context, Span) {
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+
+	ctx, span := t.Start(ctx, name)
+	if len(attrs) > 0 {
+		span.SetAttributes(attrs...)
+	}
+	return ctx, span
+}
+
+// EndSpan records err, if any, on span and ends it.
+func EndSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
@@ -0,0 +1,78 @@
+package unifi
+
+import (
+	"strings"
+)
+
+// JoinTXTStrings returns the concatenation of the strings in text if it is
+// in the zone file form of two or more quoted character strings, such as a
+// DKIM key copied from a zone file:
+//
+//	"v=DKIM1; k=rsa; " "p=MIIBIjANBgkqh..."
+//
+// The text must be exactly such a sequence as defined by RFC 1035: strings
+// separated by spaces or tabs, each at most 255 bytes long, using only the
+// escapes \X for a non-digit X and \DDD. Any other text, including a single
+// quoted string or text with other quotes in it, is returned unchanged, as
+// libdns expects TXT text without quoting.
+//
+// Text is joined both when converting records to policies and when reading
+// policies back, so a policy stored in this form by another client is
+// returned, and matched, as the joined text.
+func JoinTXTStrings(text string) string {
+	var joined strings.Builder
+	n := 0
+
+	s := text
+	for s != "" {
+		if n > 0 {
+			trimmed := strings.TrimLeft(s, " \t")
+			if trimmed == s || trimmed == "" {
+				return text // strings not separated, or trailing space
+			}
+			s = trimmed
+		}
+		if s[0] != '"' {
+			return text
+		}
+
+		size := 0
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			c := s[i]
+			if c == '\\' {
+				switch {
+				case i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]):
+					v := int(s[i+1]-'0')*100 + int(s[i+2]-'0')*10 + int(s[i+3]-'0')
+					if v > 255 {
+						return text
+					}
+					c = byte(v)
+					i += 3
+				case i+1 < len(s) && !isDigit(s[i+1]):
+					i++
+					c = s[i]
+				default:
+					return text
+				}
+			}
+			joined.WriteByte(c)
+			size++
+		}
+		if i >= len(s) || size > 255 {
+			return text // unterminated or too long
+		}
+
+		n++
+		s = s[i+1:]
+	}
+
+	if n < 2 {
+		return text
+	}
+	return joined.String()
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
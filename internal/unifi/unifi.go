@@ -9,13 +9,25 @@ import (
 	"io"
 	"net/http"
 	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/libdns/libdns"
 )
 
+// DefaultTimeout is the default timeout of a single API request.
 const DefaultTimeout = 30 * time.Second
 
+// DefaultMaxRetries is the number of times a request throttled by the
+// controller (HTTP 429) is retried before giving up.
+const DefaultMaxRetries = 3
+
+// maxRetryDelay caps the delay before retrying a throttled request.
+const maxRetryDelay = 30 * time.Second
+
 // RecordType constants represent the Unifi DNS policy types.
 const (
 	RecordTypeA       = "A_RECORD"
@@ -27,18 +39,39 @@ const (
 	RecordTypeForward = "FORWARD_DOMAIN"
 )
 
+// PolicyType returns the policy type for a libdns record type such as
+// "A" or "TXT".
+func PolicyType(rrType string) (string, error) {
+	switch strings.ToUpper(rrType) {
+	case "A":
+		return RecordTypeA, nil
+	case "AAAA":
+		return RecordTypeAAAA, nil
+	case "CNAME":
+		return RecordTypeCNAME, nil
+	case "MX":
+		return RecordTypeMX, nil
+	case "TXT":
+		return RecordTypeTXT, nil
+	case "SRV":
+		return RecordTypeSRV, nil
+	default:
+		return "", fmt.Errorf("unsupported record type: %s", rrType)
+	}
+}
+
 // LibdnsToPolicy converts a libdns record to a Unifi DNS policy.
 // The zone parameter is required to construct the full domain name.
 // For example, with record name "www" and zone "example.com", the domain becomes "www.example.com".
 func LibdnsToPolicy(record libdns.Record, zone string) (DNSPolicy, error) {
-	ttl := int32(record.RR().TTL.Seconds())
+	ttl := policyTTL(record.RR().TTL)
 
-	// Construct full domain name by appending zone to record name
-	domain := record.RR().Name
-	if domain != "" && domain != "@" {
-		domain = domain + "." + zone
-	} else {
-		domain = zone
+	if err := checkWildcard(record.RR().Name); err != nil {
+		return DNSPolicy{}, err
+	}
+	domain, err := PolicyDomain(record.RR().Name, zone)
+	if err != nil {
+		return DNSPolicy{}, err
 	}
 
 	switch r := record.(type) {
@@ -71,10 +104,12 @@ func LibdnsToPolicy(record libdns.Record, zone string) (DNSPolicy, error) {
 		}, nil
 
 	case libdns.TXT:
+		// UniFi stores the text as a single value and splits it into
+		// strings of up to 255 bytes when serving it
 		return DNSPolicy{
 			Type:    RecordTypeTXT,
 			Domain:  domain,
-			Text:    r.Text,
+			Text:    JoinTXTStrings(r.Text),
 			Enabled: true,
 			// TTLSeconds: ttl, # Not supported
 		}, nil
@@ -84,20 +119,25 @@ func LibdnsToPolicy(record libdns.Record, zone string) (DNSPolicy, error) {
 			Type:             RecordTypeMX,
 			Domain:           domain,
 			MailServerDomain: r.Target,
-			Priority:         r.Preference,
+			Priority:         Ptr(r.Preference),
 			Enabled:          true,
 			// TTLSeconds:       ttl, # Not supported
 		}, nil
 	case libdns.SRV:
+		// RR().Name includes the service and protocol
+		domain, err := PolicyDomain(r.Name, zone)
+		if err != nil {
+			return DNSPolicy{}, err
+		}
 		return DNSPolicy{
 			Type:         RecordTypeSRV,
-			Domain:       zone,
+			Domain:       domain,
 			ServerDomain: r.Target,
 			Service:      r.Service,
 			Protocol:     "_" + r.Transport,
-			Port:         r.Port,
-			Weight:       r.Weight,
-			Priority:     r.Priority,
+			Port:         Ptr(r.Port),
+			Weight:       Ptr(r.Weight),
+			Priority:     Ptr(r.Priority),
 			Enabled:      true,
 			// TTLSeconds:   ttl, # Not supported
 		}, nil
@@ -106,19 +146,23 @@ func LibdnsToPolicy(record libdns.Record, zone string) (DNSPolicy, error) {
 	}
 }
 
+// policyTTL returns the TTLSeconds of a policy for a libdns TTL. As libdns
+// suggests, a zero TTL leaves the TTL unset so that the controller applies
+// its default, while a sub-second TTL asks for 0 seconds, i.e. no caching.
+func policyTTL(ttl time.Duration) *int32 {
+	if ttl == 0 {
+		return nil
+	}
+	return Ptr(int32(ttl / time.Second))
+}
+
 // PolicyToLibdns converts a Unifi DNS policy to a libdns record.
 // The zone parameter is required to extract the relative record name from the full domain.
 // For example, with domain "www.example.com" and zone "example.com", the name becomes "www".
 func PolicyToLibdns(policy DNSPolicy, zone string) (libdns.Record, error) {
-	ttl := time.Duration(policy.TTLSeconds) * time.Second
+	ttl := time.Duration(Deref(policy.TTLSeconds)) * time.Second
 
-	// Extract relative name by removing zone suffix from domain
-	name := policy.Domain
-	if name == zone {
-		name = "@"
-	} else if len(name) > len(zone) && name[len(name)-len(zone):] == zone {
-		name = name[:len(name)-len(zone)-1] // Remove zone and the preceding dot
-	}
+	name := RelativeName(policy.Domain, zone)
 
 	switch policy.Type {
 	case RecordTypeA:
@@ -160,12 +204,10 @@ func PolicyToLibdns(policy DNSPolicy, zone string) (libdns.Record, error) {
 		}, nil
 
 	case RecordTypeTXT:
-		if policy.Text == "" {
-			return nil, fmt.Errorf("text is required for TXT_RECORD")
-		}
+		// Empty text is a valid TXT record
 		return libdns.TXT{
 			Name: name,
-			Text: policy.Text,
+			Text: JoinTXTStrings(policy.Text),
 			TTL:  ttl,
 		}, nil
 
@@ -173,14 +215,9 @@ func PolicyToLibdns(policy DNSPolicy, zone string) (libdns.Record, error) {
 		if policy.MailServerDomain == "" {
 			return nil, fmt.Errorf("mail server domain and priority are required for MX_RECORD")
 		}
-		// Use the Priority field if available, otherwise use 0
-		preference := policy.Priority
-		if preference == 0 {
-			preference = 10 // Default preference value
-		}
 		return libdns.MX{
 			Name:       name,
-			Preference: preference,
+			Preference: Deref(policy.Priority),
 			Target:     policy.MailServerDomain,
 			TTL:        ttl,
 		}, nil
@@ -190,12 +227,12 @@ func PolicyToLibdns(policy DNSPolicy, zone string) (libdns.Record, error) {
 			return nil, fmt.Errorf("server domain is required for SRV_RECORD")
 		}
 		return libdns.SRV{
-			Name:      policy.Domain,
-			Service:   policy.Service,
-			Transport: policy.Protocol,
-			Priority:  policy.Priority,
-			Weight:    policy.Weight,
-			Port:      policy.Port,
+			Name:      name,
+			Service:   strings.TrimPrefix(policy.Service, "_"),
+			Transport: strings.TrimPrefix(policy.Protocol, "_"),
+			Priority:  Deref(policy.Priority),
+			Weight:    Deref(policy.Weight),
+			Port:      Deref(policy.Port),
 			Target:    policy.ServerDomain,
 			TTL:       ttl,
 		}, nil
@@ -207,13 +244,15 @@ func PolicyToLibdns(policy DNSPolicy, zone string) (libdns.Record, error) {
 
 // DNSPolicy represents a DNS policy record from the API.
 // It supports multiple record types with type-specific fields.
+// Numeric fields are pointers so that an unset field, which is omitted
+// and left to the controller's default, differs from an explicit zero.
 type DNSPolicy struct {
 	// Common fields for all record types
 	Type       string `json:"type"`
 	ID         string `json:"id,omitempty"`
 	Enabled    bool   `json:"enabled"`
 	Domain     string `json:"domain"`
-	TTLSeconds int32  `json:"ttlSeconds,omitempty"`
+	TTLSeconds *int32 `json:"ttlSeconds,omitempty"`
 
 	// Address record fields (A_RECORD, AAAA_RECORD)
 	IPv4Address string `json:"ipv4Address,omitempty"`
@@ -225,16 +264,34 @@ type DNSPolicy struct {
 	// TXT record fields
 	Text string `json:"text,omitempty"`
 
-	// MX record fields
-	MailServerDomain string `json:"mailServerDomain,omitempty"`
-	Priority         uint16 `json:"priority,omitempty"`
+	// MX record fields (Priority is shared with SRV records)
+	MailServerDomain string  `json:"mailServerDomain,omitempty"`
+	Priority         *uint16 `json:"priority,omitempty"`
 
 	// SRV record fields
-	ServerDomain string `json:"serverDomain,omitempty"`
-	Service      string `json:"service,omitempty"`
-	Protocol     string `json:"protocol,omitempty"`
-	Port         uint16 `json:"port,omitempty"`
-	Weight       uint16 `json:"weight,omitempty"`
+	ServerDomain string  `json:"serverDomain,omitempty"`
+	Service      string  `json:"service,omitempty"`
+	Protocol     string  `json:"protocol,omitempty"`
+	Port         *uint16 `json:"port,omitempty"`
+	Weight       *uint16 `json:"weight,omitempty"`
+
+	// Extra holds the fields of the API's JSON that DNSPolicy does not
+	// declare. They are sent back as received when the policy is written.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Ptr returns a pointer to v, for the optional fields of DNSPolicy.
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// Deref returns the value p points to, or the zero value if p is nil.
+func Deref[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
 }
 
 // ListResponse represents the response from the list DNS policies endpoint
@@ -246,52 +303,233 @@ type ListResponse struct {
 	Data       []DNSPolicy `json:"data"`
 }
 
+// Site represents a site of the UniFi Network application.
+type Site struct {
+	ID                string `json:"id"`
+	InternalReference string `json:"internalReference"`
+	Name              string `json:"name"`
+}
+
 // Client provides methods to interact with the Unifi DNS API.
 // It handles HTTP communication and request/response serialization.
 type Client struct {
-	apiKey     string
-	baseURL    string
-	httpClient *http.Client
+	staticKey   string
+	credentials Credentials
+	baseURL     string
+	discovered  string
+	baseMu      sync.Mutex
+	httpClient  *http.Client
+	transport   http.RoundTripper
+	tlsConfig   *tls.Config
+	tlsSet      bool
+	maxRetries  int
+
+	requestTimeout time.Duration
+	listTimeout    time.Duration
+
+	limiter *rateLimiter
+	logger  Logger
+	metrics Metrics
+	tracer  Tracer
+}
+
+// Option configures optional behavior of a Client.
+type Option func(*Client)
+
+// WithRateLimit limits the client to rate requests per second on average,
+// allowing bursts of up to burst requests. Every request, including retries,
+// waits for the limiter. A rate of zero or less disables limiting.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(c *Client) {
+		if rate > 0 {
+			c.limiter = newRateLimiter(rate, burst)
+		} else {
+			c.limiter = nil
+		}
+	}
 }
 
 // NewClient creates a new API client for the Unifi DNS API.
-// It configures the client to accept self-signed/invalid SSL certificates,
-// which is common for local Unifi installations.
-func NewClient(apiKey, baseURL string) *Client {
-	// Create a custom TLS configuration that skips certificate verification
-	// This is necessary for Unifi controllers with self-signed certificates
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
-	}
-
-	// Create a custom HTTP transport with the TLS configuration
-	transport := &http.Transport{
-		TLSClientConfig: tlsConfig,
-	}
-
-	return &Client{
-		apiKey:  apiKey,
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout:   DefaultTimeout,
-			Transport: transport,
+// Unless WithTLSConfig is given, it configures the client to accept
+// self-signed/invalid SSL certificates, which is common for local Unifi installations.
+// An *http.Transport given to WithTransport or WithHTTPClient is cloned to
+// apply the TLS configuration, unless it has its own and WithTLSConfig is not
+// given; any other transport is used as is.
+func NewClient(apiKey, baseURL string, opts ...Option) *Client {
+	c := &Client{
+		staticKey:      apiKey,
+		baseURL:        baseURL,
+		maxRetries:     DefaultMaxRetries,
+		requestTimeout: DefaultTimeout,
+
+		// Create a custom TLS configuration that skips certificate verification
+		// This is necessary for Unifi controllers with self-signed certificates
+		tlsConfig: &tls.Config{
+			InsecureSkipVerify: true,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	httpClient := &http.Client{}
+	if c.httpClient != nil {
+		clone := *c.httpClient
+		httpClient = &clone
+	}
+	if c.transport != nil {
+		httpClient.Transport = c.transport
+	}
+	switch t := httpClient.Transport.(type) {
+	case nil:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = c.tlsConfig
+		httpClient.Transport = transport
+	case *http.Transport:
+		if c.tlsSet || t.TLSClientConfig == nil {
+			transport := t.Clone()
+			transport.TLSClientConfig = c.tlsConfig
+			httpClient.Transport = transport
+		}
+	}
+	c.httpClient = httpClient
+
+	return c
+}
+
+// WithHTTPClient makes the client send requests with a copy of httpClient,
+// keeping its timeout, cookie jar and redirect policy. Its transport, if
+// set, is treated like one given to WithTransport.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTransport makes the client send requests through rt, replacing the
+// transport of the http.Client. An *http.Transport is cloned to apply the
+// TLS configuration as described at NewClient; other transports are used as
+// is, so that they can share a connection pool or record requests.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = rt
+	}
+}
+
+// WithRequestTimeout bounds every attempt of an API request to d, replacing
+// DefaultTimeout. Zero disables the timeout. A shorter context deadline
+// still applies.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.requestTimeout = d
+	}
+}
+
+// WithListTimeout bounds a ListPolicies call, including all its pages,
+// to d. Zero disables the timeout. A shorter context deadline still applies.
+func WithListTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.listTimeout = d
+	}
+}
+
+// WithTLSConfig replaces the TLS configuration of the default transport,
+// which skips certificate verification. It also applies to an
+// *http.Transport given to WithTransport or WithHTTPClient, but not to
+// other transports.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+		c.tlsSet = true
+	}
 }
 
 // ListPolicies retrieves all DNS policies for a site from the Unifi API.
 // It fetches up to 1000 policies using pagination, making multiple requests as needed.
+// All pages together are bounded by the list timeout, if one is configured.
+// The like filter's * also matches the literal * of wildcard policies, and
+// controllers differ in how they match, so the result is checked again:
+// only the zone itself and names below it (including wildcards) are kept.
 func (c *Client) ListPolicies(ctx context.Context, siteID string, zone string) ([]DNSPolicy, error) {
+	zone = strings.TrimSuffix(zone, ".")
+	quoted, err := quoteFilter(zone)
+	if err != nil {
+		return nil, err
+	}
+	wildcard, _ := quoteFilter("*." + zone) // valid, as the zone is
+	filter := fmt.Sprintf("or(domain.eq(%s),domain.like(%s))", quoted, wildcard)
+	policies, err := c.listPolicies(ctx, siteID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	inZone := policies[:0]
+	for _, policy := range policies {
+		if InZone(policy.Domain, zone) {
+			inZone = append(inZone, policy)
+		}
+	}
+	return inZone, nil
+}
+
+// FindPolicies retrieves the DNS policies for a single domain, and of a
+// single type unless policyType is empty. The controller filters them, so
+// unlike ListPolicies this does not fetch the whole zone.
+func (c *Client) FindPolicies(ctx context.Context, siteID, domain, policyType string) ([]DNSPolicy, error) {
+	quoted, err := quoteFilter(domain)
+	if err != nil {
+		return nil, err
+	}
+	filter := fmt.Sprintf("domain.eq(%s)", quoted)
+	if policyType != "" {
+		quoted, err := quoteFilter(policyType)
+		if err != nil {
+			return nil, err
+		}
+		filter = fmt.Sprintf("and(%s,type.eq(%s))", filter, quoted)
+	}
+	return c.listPolicies(ctx, siteID, filter)
+}
+
+// quoteFilter returns s as a string literal of a filter expression, enclosed
+// in single quotes. The filter syntax of the integration API documents no
+// escapes, so values with quotes or backslashes, which no valid domain name
+// has, are rejected rather than escaped in a way the controller may not read.
+func quoteFilter(s string) (string, error) {
+	if strings.ContainsAny(s, `'\`) {
+		return "", fmt.Errorf("invalid filter value %q: quotes and backslashes are not supported", s)
+	}
+	return "'" + s + "'", nil
+}
+
+// listPolicies retrieves the DNS policies matching filter, page by page.
+func (c *Client) listPolicies(ctx context.Context, siteID, filter string) ([]DNSPolicy, error) {
 	const maxRecords = 1000
 	const pageSize = 25
 
+	if c.listTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.listTimeout)
+		defer cancel()
+	}
+
+	base, err := c.BaseURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var allPolicies []DNSPolicy
 	offset := 0
 
 	for {
-		url := fmt.Sprintf("%s/sites/%s/dns/policies?offset=%d&limit=%d&filter=or(domain.eq('%s'),domain.like('*%s'))", c.baseURL, siteID, offset, pageSize, zone, zone)
+		query := url.Values{
+			"offset": {strconv.Itoa(offset)},
+			"limit":  {strconv.Itoa(pageSize)},
+			"filter": {filter},
+		}
+		endpoint := fmt.Sprintf("%s/sites/%s/dns/policies?%s", base, siteID, query.Encode())
 
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create request: %w", err)
 		}
@@ -324,9 +562,106 @@ func (c *Client) ListPolicies(ctx context.Context, siteID string, zone string) (
 	return allPolicies, nil
 }
 
+// ListSites retrieves all sites the API key has access to.
+func (c *Client) ListSites(ctx context.Context) ([]Site, error) {
+	const pageSize = 25
+
+	base, err := c.BaseURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var sites []Site
+	for offset := 0; ; offset += pageSize {
+		url := fmt.Sprintf("%s/sites?offset=%d&limit=%d", base, offset, pageSize)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			TotalCount int32  `json:"totalCount"`
+			Data       []Site `json:"data"`
+		}
+		if err := json.Unmarshal(resp, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+
+		sites = append(sites, page.Data...)
+		if len(page.Data) == 0 || int32(len(sites)) >= page.TotalCount {
+			return sites, nil
+		}
+	}
+}
+
+// CountPolicies returns the number of DNS policies of a site,
+// fetching a single policy to do so.
+func (c *Client) CountPolicies(ctx context.Context, siteID string) (int, error) {
+	base, err := c.BaseURL(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	url := fmt.Sprintf("%s/sites/%s/dns/policies?limit=1", base, siteID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	var listResp ListResponse
+	if err := json.Unmarshal(resp, &listResp); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return int(listResp.TotalCount), nil
+}
+
+// GetPolicy retrieves a single DNS policy by its ID from the Unifi API.
+func (c *Client) GetPolicy(ctx context.Context, siteID, policyID string) (DNSPolicy, error) {
+	base, err := c.BaseURL(ctx)
+	if err != nil {
+		return DNSPolicy{}, err
+	}
+
+	url := fmt.Sprintf("%s/sites/%s/dns/policies/%s", base, siteID, policyID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return DNSPolicy{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return DNSPolicy{}, err
+	}
+
+	var policy DNSPolicy
+	if err := json.Unmarshal(resp, &policy); err != nil {
+		return DNSPolicy{}, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return policy, nil
+}
+
 // CreatePolicy creates a new DNS policy in the Unifi API.
 func (c *Client) CreatePolicy(ctx context.Context, siteID string, policy DNSPolicy) (DNSPolicy, error) {
-	url := fmt.Sprintf("%s/sites/%s/dns/policies", c.baseURL, siteID)
+	base, err := c.BaseURL(ctx)
+	if err != nil {
+		return DNSPolicy{}, err
+	}
+
+	url := fmt.Sprintf("%s/sites/%s/dns/policies", base, siteID)
 
 	body, err := json.Marshal(policy)
 	if err != nil {
@@ -352,8 +687,17 @@ func (c *Client) CreatePolicy(ctx context.Context, siteID string, policy DNSPoli
 }
 
 // UpdatePolicy updates an existing DNS policy in the Unifi API.
+// Only the fields set in policy are sent: nil numeric fields and empty
+// optional strings are omitted, while explicit zeros are sent as such.
+// The policy is replaced as a whole; use PatchPolicy to keep the fields
+// policy does not set.
 func (c *Client) UpdatePolicy(ctx context.Context, siteID, policyID string, policy DNSPolicy) (DNSPolicy, error) {
-	url := fmt.Sprintf("%s/sites/%s/dns/policies/%s", c.baseURL, siteID, policyID)
+	base, err := c.BaseURL(ctx)
+	if err != nil {
+		return DNSPolicy{}, err
+	}
+
+	url := fmt.Sprintf("%s/sites/%s/dns/policies/%s", base, siteID, policyID)
 
 	body, err := json.Marshal(policy)
 	if err != nil {
@@ -378,9 +722,27 @@ func (c *Client) UpdatePolicy(ctx context.Context, siteID, policyID string, poli
 	return updated, nil
 }
 
+// PatchPolicy updates an existing DNS policy by reading it, applying the
+// fields set in changes and writing it back, so that fields changes does
+// not set, including fields unknown to DNSPolicy, keep their values.
+// Unset fields are those UpdatePolicy would omit; Enabled is always applied.
+func (c *Client) PatchPolicy(ctx context.Context, siteID, policyID string, changes DNSPolicy) (DNSPolicy, error) {
+	current, err := c.GetPolicy(ctx, siteID, policyID)
+	if err != nil {
+		return DNSPolicy{}, fmt.Errorf("failed to get DNS policy: %w", err)
+	}
+
+	return c.UpdatePolicy(ctx, siteID, policyID, mergePolicy(current, changes))
+}
+
 // DeletePolicy deletes a DNS policy from the Unifi API.
 func (c *Client) DeletePolicy(ctx context.Context, siteID, policyID string) error {
-	url := fmt.Sprintf("%s/sites/%s/dns/policies/%s", c.baseURL, siteID, policyID)
+	base, err := c.BaseURL(ctx)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/sites/%s/dns/policies/%s", base, siteID, policyID)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if err != nil {
@@ -391,28 +753,141 @@ func (c *Client) DeletePolicy(ctx context.Context, siteID, policyID string) erro
 	return err
 }
 
-// do sends an HTTP request and returns the response body or an error
+// do sends an HTTP request and returns the response body or an error.
+// Requests throttled by the controller are retried after the delay it asks for,
+// and a request whose API key is rejected is retried once if refreshing the
+// credentials yields a different key.
+// Every attempt passes through the rate limiter, if one is configured.
 func (c *Client) do(req *http.Request) ([]byte, error) {
+	ctx, span := StartSpan(req.Context(), c.tracer, "unifi.http.request",
+		Attribute{"http.request.method", req.Method},
+		Attribute{"url.path", endpointTemplate(req.URL.Path)},
+	)
+	req = req.WithContext(ctx)
+	start := time.Now()
+
+	key, err := c.apiKey(ctx)
+	if err != nil {
+		c.observeRequest(req, span, 0, start, 0, err)
+		return nil, err
+	}
+
 	// Set default headers
 	req.Header.Set("Content-Type", "application/json")
-	if c.apiKey != "" {
-		req.Header.Set("X-API-KEY", c.apiKey)
+	if key != "" {
+		req.Header.Set("X-API-KEY", key)
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				err = fmt.Errorf("failed to rewind request body: %w", err)
+				c.observeRequest(req, span, 0, start, attempt, err)
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		if c.limiter != nil {
+			if err := c.limiter.wait(req.Context()); err != nil {
+				c.observeRequest(req, span, 0, start, attempt, err)
+				return nil, err
+			}
+		}
+
+		resp, bodyBytes, err := c.send(req)
+		if err != nil {
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			c.observeRequest(req, span, status, start, attempt, err)
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < c.maxRetries {
+			timer := time.NewTimer(retryDelay(resp.Header.Get("Retry-After"), attempt))
+			select {
+			case <-req.Context().Done():
+				timer.Stop()
+				c.observeRequest(req, span, resp.StatusCode, start, attempt, req.Context().Err())
+				return nil, req.Context().Err()
+			case <-timer.C:
+			}
+			continue
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && !refreshed {
+			refreshed = true
+			if newKey, ok := c.refreshKey(req.Context(), key); ok {
+				key = newKey
+				req.Header.Set("X-API-KEY", key)
+				continue
+			}
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			err := &APIError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+			c.observeRequest(req, span, resp.StatusCode, start, attempt, err)
+			return nil, err
+		}
+
+		c.observeRequest(req, span, resp.StatusCode, start, attempt, nil)
+		return bodyBytes, nil
+	}
+}
+
+// APIError is returned for a response with a non-2xx status code.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
+}
+
+// send performs a single attempt of req, bounded by the request timeout,
+// and returns the response with its body.
+func (c *Client) send(req *http.Request) (*http.Response, []byte, error) {
+	if c.requestTimeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), c.requestTimeout)
+		defer cancel()
+		req = req.WithContext(ctx)
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, nil, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return resp, nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(bodyBytes))
+	return resp, bodyBytes, nil
+}
+
+// retryDelay returns how long to wait before retrying a throttled request,
+// honoring the Retry-After header (in seconds or as an HTTP date) and
+// backing off exponentially otherwise.
+func retryDelay(retryAfter string, attempt int) time.Duration {
+	delay := time.Second << attempt
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(retryAfter); err == nil {
+		delay = time.Until(t)
+		if delay < 0 {
+			delay = 0
+		}
 	}
 
-	return bodyBytes, nil
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
 }
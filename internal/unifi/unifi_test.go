@@ -0,0 +1,547 @@
+package unifi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// TestTXTRoundTrip tests that TXT text survives conversion to a policy, JSON and back
+func TestTXTRoundTrip(t *testing.T) {
+	dkim := "v=DKIM1; k=rsa; p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A", 12)
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "plain", text: "hello world", want: "hello world"},
+		{name: "empty", text: "", want: ""},
+		{name: "long", text: dkim, want: dkim},
+		{name: "single quoted string kept", text: `"heritage=external-dns,external-dns/owner=default"`, want: `"heritage=external-dns,external-dns/owner=default"`},
+		{name: "quotes and backslashes", text: `say "hi" \ bye`, want: `say "hi" \ bye`},
+		{name: "unicode", text: "grüße ✓", want: "grüße ✓"},
+		{name: "multiple strings joined", text: `"v=DKIM1; k=rsa; " "p=MIIB"`, want: "v=DKIM1; k=rsa; p=MIIB"},
+		{name: "escapes in multiple strings", text: `"a\"b" "c\\d" "\065"`, want: `a"bc\dA`},
+		{name: "unterminated strings kept", text: `"a" "b`, want: `"a" "b`},
+		{name: "text between strings kept", text: `"a" b "c"`, want: `"a" b "c"`},
+		{name: "unseparated strings kept", text: `"a""b"`, want: `"a""b"`},
+		{name: "surrounding space kept", text: ` "a" "b" `, want: ` "a" "b" `},
+		{name: "short decimal escape kept", text: `"a" "\1"`, want: `"a" "\1"`},
+		{name: "long string kept", text: `"a" "` + strings.Repeat("b", 256) + `"`, want: `"a" "` + strings.Repeat("b", 256) + `"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := LibdnsToPolicy(libdns.TXT{Name: "www", Text: tt.text}, "example.com")
+			if err != nil {
+				t.Fatalf("LibdnsToPolicy failed: %v", err)
+			}
+
+			data, err := json.Marshal(policy)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if !strings.Contains(string(data), `"text":`) {
+				t.Errorf("Expected text to be sent, got %s", data)
+			}
+
+			var decoded DNSPolicy
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+
+			record, err := PolicyToLibdns(decoded, "example.com")
+			if err != nil {
+				t.Fatalf("PolicyToLibdns failed: %v", err)
+			}
+			if got := record.(libdns.TXT).Text; got != tt.want {
+				t.Errorf("Expected text %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMarshalOmitsTextOfOtherTypes(t *testing.T) {
+	data, err := json.Marshal(DNSPolicy{Type: RecordTypeA, Domain: "www.example.com", IPv4Address: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"text"`) {
+		t.Errorf("Expected no text for an A policy, got %s", data)
+	}
+}
+
+// TestMXPreference tests that MX preference 0 is sent and read back instead of being replaced
+func TestMXPreference(t *testing.T) {
+	for _, preference := range []uint16{0, 10} {
+		policy, err := LibdnsToPolicy(libdns.MX{Name: "@", Preference: preference, Target: "mail.example.com"}, "example.com")
+		if err != nil {
+			t.Fatalf("LibdnsToPolicy failed: %v", err)
+		}
+
+		data, err := json.Marshal(policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf(`"priority":%d`, preference); !strings.Contains(string(data), want) {
+			t.Errorf("Expected %s in %s", want, data)
+		}
+
+		var decoded DNSPolicy
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		record, err := PolicyToLibdns(decoded, "example.com")
+		if err != nil {
+			t.Fatalf("PolicyToLibdns failed: %v", err)
+		}
+		if got := record.(libdns.MX).Preference; got != preference {
+			t.Errorf("Expected preference %d, got %d", preference, got)
+		}
+	}
+
+	// A policy without a priority has preference 0
+	record, err := PolicyToLibdns(DNSPolicy{Type: RecordTypeMX, Domain: "example.com", MailServerDomain: "mail.example.com"}, "example.com")
+	if err != nil {
+		t.Fatalf("PolicyToLibdns failed: %v", err)
+	}
+	if got := record.(libdns.MX).Preference; got != 0 {
+		t.Errorf("Expected preference 0 for a missing priority, got %d", got)
+	}
+}
+
+// TestZeroValues tests that unset numeric fields are omitted while explicit zeros are sent
+func TestZeroValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		record libdns.Record
+		want   map[string]any
+	}{
+		{
+			name:   "default TTL",
+			record: libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+			want:   map[string]any{"type": RecordTypeA, "domain": "www.example.com", "ipv4Address": "192.0.2.1", "enabled": true},
+		},
+		{
+			name:   "TTL of 0 seconds",
+			record: libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Nanosecond},
+			want:   map[string]any{"type": RecordTypeA, "domain": "www.example.com", "ipv4Address": "192.0.2.1", "enabled": true, "ttlSeconds": 0.0},
+		},
+		{
+			name:   "TTL",
+			record: libdns.CNAME{Name: "www", Target: "example.com", TTL: 5 * time.Minute},
+			want:   map[string]any{"type": RecordTypeCNAME, "domain": "www.example.com", "targetDomain": "example.com", "enabled": true, "ttlSeconds": 300.0},
+		},
+		{
+			name:   "SRV with zero weight and priority",
+			record: libdns.SRV{Service: "sip", Transport: "udp", Name: "@", Port: 5060, Target: "sip.example.com"},
+			want: map[string]any{
+				"type": RecordTypeSRV, "domain": "example.com", "serverDomain": "sip.example.com", "enabled": true,
+				"service": "sip", "protocol": "_udp", "port": 5060.0, "weight": 0.0, "priority": 0.0,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := LibdnsToPolicy(tt.record, "example.com")
+			if err != nil {
+				t.Fatalf("LibdnsToPolicy failed: %v", err)
+			}
+
+			data, err := json.Marshal(policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestUpdatePolicySendsIntendedFields tests the body of an update request
+func TestUpdatePolicySendsIntendedFields(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("Expected PUT, got %s", r.Method)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("key", server.URL+"/integration/v1")
+	_, err := client.UpdatePolicy(context.Background(), "site", "policy", DNSPolicy{
+		Type:        RecordTypeA,
+		Domain:      "www.example.com",
+		IPv4Address: "192.0.2.1",
+		TTLSeconds:  Ptr(int32(0)),
+		Enabled:     true,
+	})
+	if err != nil {
+		t.Fatalf("UpdatePolicy failed: %v", err)
+	}
+
+	want := map[string]any{"type": RecordTypeA, "domain": "www.example.com", "ipv4Address": "192.0.2.1", "ttlSeconds": 0.0, "enabled": true}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("Expected body %v, got %v", want, body)
+	}
+}
+
+// TestPatchPolicy tests that a patch keeps the fields the changes do not set
+func TestPatchPolicy(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte(`{"id":"policy","type":"A_RECORD","enabled":false,"domain":"www.example.com","ipv4Address":"192.0.2.1","ttlSeconds":600,"metadata":{"origin":"USER_DEFINED"}}`))
+		case http.MethodPut:
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Error(err)
+			}
+			w.Write([]byte(`{}`))
+		default:
+			t.Errorf("Unexpected %s request", r.Method)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("key", server.URL+"/integration/v1")
+	_, err := client.PatchPolicy(context.Background(), "site", "policy", DNSPolicy{
+		Type:        RecordTypeA,
+		Domain:      "www.example.com",
+		IPv4Address: "192.0.2.2",
+		Enabled:     true,
+	})
+	if err != nil {
+		t.Fatalf("PatchPolicy failed: %v", err)
+	}
+
+	want := map[string]any{
+		"id":          "policy",
+		"type":        RecordTypeA,
+		"domain":      "www.example.com",
+		"ipv4Address": "192.0.2.2",
+		"ttlSeconds":  600.0,
+		"enabled":     true,
+		"metadata":    map[string]any{"origin": "USER_DEFINED"},
+	}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("Expected body %v, got %v", want, body)
+	}
+}
+
+// TestMergePolicyChangesType tests that a merge with another type drops the fields of the old one
+func TestMergePolicyChangesType(t *testing.T) {
+	current := DNSPolicy{
+		ID:          "policy",
+		Type:        RecordTypeA,
+		Domain:      "www.example.com",
+		IPv4Address: "192.0.2.1",
+		TTLSeconds:  Ptr(int32(600)),
+		Extra:       map[string]json.RawMessage{"metadata": json.RawMessage(`{}`)},
+	}
+	changes := DNSPolicy{
+		Type:         RecordTypeCNAME,
+		Domain:       "www.example.com",
+		TargetDomain: "example.com",
+		Enabled:      true,
+	}
+
+	want := changes
+	want.ID = "policy"
+	want.Extra = current.Extra
+	if got := mergePolicy(current, changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+// TestPolicyExtraRoundTrip tests that unknown JSON fields survive decoding and encoding
+func TestPolicyExtraRoundTrip(t *testing.T) {
+	in := `{"id":"policy","type":"TXT_RECORD","enabled":true,"domain":"example.com","text":"","createdAt":"2026-01-01T00:00:00Z","metadata":{"origin":"USER_DEFINED","tags":[1,2]}}`
+
+	var policy DNSPolicy
+	if err := json.Unmarshal([]byte(in), &policy); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(policy.Extra) != 2 || string(policy.Extra["createdAt"]) != `"2026-01-01T00:00:00Z"` {
+		t.Errorf("Unexpected extra fields %v", policy.Extra)
+	}
+
+	// A declared field in Extra does not override the policy's own value
+	policy.Extra["domain"] = json.RawMessage(`"other.example.com"`)
+	out, err := json.Marshal(policy)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var got, want map[string]any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(in), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %s, got %s", in, out)
+	}
+
+	// Decoding into a used policy drops the old extra fields
+	if err := json.Unmarshal([]byte(`{"type":"A_RECORD"}`), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if policy.Extra != nil {
+		t.Errorf("Expected no extra fields, got %v", policy.Extra)
+	}
+}
+
+// TestWildcardNames tests that wildcard names convert in both directions and invalid ones are rejected
+func TestWildcardNames(t *testing.T) {
+	for name, domain := range map[string]string{
+		"*":         "*.example.com",
+		"*.sub":     "*.sub.example.com",
+		"*.a.b.sub": "*.a.b.sub.example.com",
+	} {
+		policy, err := LibdnsToPolicy(libdns.Address{Name: name, IP: netip.MustParseAddr("192.0.2.1")}, "example.com")
+		if err != nil {
+			t.Fatalf("LibdnsToPolicy(%q) failed: %v", name, err)
+		}
+		if policy.Domain != domain {
+			t.Errorf("LibdnsToPolicy(%q): expected domain %s, got %s", name, domain, policy.Domain)
+		}
+
+		record, err := PolicyToLibdns(policy, "example.com")
+		if err != nil {
+			t.Fatalf("PolicyToLibdns(%q) failed: %v", domain, err)
+		}
+		if got := record.RR().Name; got != name {
+			t.Errorf("PolicyToLibdns(%q): expected name %s, got %s", domain, name, got)
+		}
+	}
+
+	for _, name := range []string{"a.*", "*a", "a*", "*.*", "**", "www.*.sub"} {
+		if _, err := LibdnsToPolicy(libdns.Address{Name: name, IP: netip.MustParseAddr("192.0.2.1")}, "example.com"); err == nil {
+			t.Errorf("LibdnsToPolicy(%q): expected an error", name)
+		}
+	}
+}
+
+// TestInZone tests that zone membership is checked on label boundaries
+func TestInZone(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"example.com", true},
+		{"www.example.com", true},
+		{"*.example.com", true},
+		{"*.sub.example.com", true},
+		{"WWW.Example.COM", true},
+		{"myexample.com", false},
+		{"*example.com", false},
+		{"example.com.evil.org", false},
+		{"com", false},
+	}
+	for _, tt := range tests {
+		if got := InZone(tt.domain, "example.com"); got != tt.want {
+			t.Errorf("InZone(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
+
+// TestNames tests the conversion between record names and policy domains
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name, zone, domain string
+	}{
+		{"www", "example.com", "www.example.com"},
+		{"www", "example.com.", "www.example.com"},
+		{"@", "example.com.", "example.com"},
+		{"a.b", "Example.COM.", "a.b.Example.COM"},
+		{"*", "example.com.", "*.example.com"},
+	}
+	for _, tt := range tests {
+		if got, err := PolicyDomain(tt.name, tt.zone); err != nil || got != tt.domain {
+			t.Errorf("PolicyDomain(%q, %q) = %q, %v, want %q", tt.name, tt.zone, got, err, tt.domain)
+		}
+		if got := RelativeName(tt.domain, tt.zone); got != tt.name {
+			t.Errorf("RelativeName(%q, %q) = %q, want %q", tt.domain, tt.zone, got, tt.name)
+		}
+	}
+
+	relative := []struct {
+		domain, zone, name string
+	}{
+		{"WWW.Example.com", "example.com.", "WWW"},
+		{"www.example.com.", "example.com", "www"},
+		{"EXAMPLE.com", "example.COM", "@"},
+		{"myexample.com", "example.com", "myexample.com."},
+		{"www.example.org", "example.com.", "www.example.org."},
+	}
+	for _, tt := range relative {
+		if got := RelativeName(tt.domain, tt.zone); got != tt.name {
+			t.Errorf("RelativeName(%q, %q) = %q, want %q", tt.domain, tt.zone, got, tt.name)
+		}
+	}
+
+	// An absolute name is kept as is if it is in the zone
+	if got, err := PolicyDomain("WWW.example.com.", "example.com."); err != nil || got != "WWW.example.com" {
+		t.Errorf("PolicyDomain of an absolute name = %q, %v", got, err)
+	}
+	if got, err := PolicyDomain("www.example.org.", "example.com."); err == nil {
+		t.Errorf("PolicyDomain of a name outside the zone = %q, want an error", got)
+	}
+}
+
+// TestSRVNames tests that SRV records keep their name, service and transport
+func TestSRVNames(t *testing.T) {
+	record := libdns.SRV{Service: "sip", Transport: "tcp", Name: "voip", Priority: 1, Weight: 2, Port: 5060, Target: "sip.example.com"}
+
+	policy, err := LibdnsToPolicy(record, "example.com.")
+	if err != nil {
+		t.Fatalf("LibdnsToPolicy failed: %v", err)
+	}
+	if policy.Domain != "voip.example.com" {
+		t.Errorf("Expected domain voip.example.com, got %s", policy.Domain)
+	}
+
+	got, err := PolicyToLibdns(policy, "example.com.")
+	if err != nil {
+		t.Fatalf("PolicyToLibdns failed: %v", err)
+	}
+	if got != record {
+		t.Errorf("Expected %+v, got %+v", record, got)
+	}
+}
+
+// TestRateLimiterBurst tests that a burst is allowed immediately and later requests wait
+func TestRateLimiterBurst(t *testing.T) {
+	l := newRateLimiter(20, 3)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatalf("wait failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("Expected burst to pass immediately, took %s", elapsed)
+	}
+
+	// Two more requests need two tokens at 20/s
+	for i := 0; i < 2; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatalf("wait failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected requests beyond the burst to be delayed, took %s", elapsed)
+	}
+}
+
+// TestRateLimiterCancel tests that waiting respects context cancellation
+func TestRateLimiterCancel(t *testing.T) {
+	l := newRateLimiter(0.1, 1)
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := l.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+// TestNormalizeBaseURL tests the accepted base URL forms and their canonical form
+func TestNormalizeBaseURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{raw: "192.168.1.1", want: "https://192.168.1.1"},
+		{raw: " unifi.local:8443/ ", want: "https://unifi.local:8443"},
+		{raw: "HTTP://192.168.1.1", want: "http://192.168.1.1"},
+		{raw: "https://192.168.1.1/proxy/network/integration/v1/", want: "https://192.168.1.1/proxy/network/integration/v1"},
+		{raw: "[fd00::1]", want: "https://[fd00::1]"},
+		{raw: "", wantErr: "base URL is empty"},
+		{raw: "ftp://192.168.1.1", wantErr: "scheme must be https or http"},
+		{raw: "https://", wantErr: "missing host"},
+		{raw: "https://192.168.1.1/?site=default", wantErr: "must not contain a query or fragment"},
+		{raw: "https://192.168.1.1:port", wantErr: "invalid base URL"},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeBaseURL(tt.raw)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NormalizeBaseURL(%q): expected error containing %q, got %v", tt.raw, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NormalizeBaseURL(%q) failed: %v", tt.raw, err)
+		} else if got != tt.want {
+			t.Errorf("NormalizeBaseURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// TestBaseURLDoesNotBlockDuringDiscovery tests that a slow probe does not
+// hold up other callers past their own deadline
+func TestBaseURLDoesNotBlockDuringDiscovery(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient("key", server.URL)
+	go client.BaseURL(context.Background())
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.BaseURL(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("BaseURL waited for another caller's discovery")
+	}
+}
@@ -0,0 +1,247 @@
+package unifitest
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/libdns/unifi/internal/dnswire"
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// maxUDPSize is the largest response sent over UDP; larger responses are
+// truncated, and the client is expected to retry over TCP.
+const maxUDPSize = 512
+
+// maxTXTString is the maximum length in bytes of a character string in a
+// TXT record.
+const maxTXTString = 255
+
+// StartDNS starts answering DNS queries over UDP and TCP from the stored
+// policies, like the gateway's resolver, and returns its address. The
+// listeners are closed by Close.
+func (s *Server) StartDNS() string {
+	conn, listener := listenDNS()
+
+	s.mu.Lock()
+	s.dnsConn = conn
+	s.dnsListener = listener
+	s.mu.Unlock()
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := s.answer(buf[:n], maxUDPSize); resp != nil {
+				_, _ = conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveTCP(c)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// listenDNS listens on the same random port for UDP and TCP.
+func listenDNS() (net.PacketConn, net.Listener) {
+	for i := 0; i < 10; i++ {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			break
+		}
+		listener, err := net.Listen("tcp", conn.LocalAddr().String())
+		if err == nil {
+			return conn, listener
+		}
+		conn.Close()
+	}
+	panic("unifitest: failed to listen for DNS")
+}
+
+// serveTCP answers length-prefixed queries on c until it is closed.
+func (s *Server) serveTCP(c net.Conn) {
+	defer c.Close()
+
+	for {
+		var length [2]byte
+		if _, err := io.ReadFull(c, length[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(c, query); err != nil {
+			return
+		}
+
+		resp := s.answer(query, 0xffff)
+		if resp == nil {
+			return
+		}
+		binary.BigEndian.PutUint16(length[:], uint16(len(resp)))
+		if _, err := c.Write(append(length[:], resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// SetDNSDelay makes policies visible to DNS queries only d after they
+// were created or updated, like a resolver that reloads its configuration
+// periodically.
+func (s *Server) SetDNSDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dnsDelay = d
+}
+
+// Close shuts down the server and its DNS listener, if started.
+func (s *Server) Close() {
+	s.Server.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dnsConn != nil {
+		s.dnsConn.Close()
+		s.dnsListener.Close()
+	}
+}
+
+// answer returns the packed response to a packed query, or nil if the
+// query cannot be parsed. Responses longer than size are truncated.
+func (s *Server) answer(query []byte, size int) []byte {
+	q, err := dnswire.Unpack(query)
+	if err != nil || q.Response || len(q.Questions) != 1 {
+		return nil
+	}
+
+	resp := dnswire.Message{
+		Header: dnswire.Header{
+			ID:                 q.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   q.RecursionDesired,
+			RecursionAvailable: true,
+			RCode:              dnswire.RCodeNameError,
+		},
+		Questions: q.Questions,
+	}
+
+	question := q.Questions[0]
+	name := strings.TrimSuffix(question.Name, ".")
+
+	s.mu.Lock()
+	for _, policy := range s.served(name) {
+		resp.RCode = dnswire.RCodeSuccess
+		if rr, ok := policyRR(policy, question.Name); ok && rr.Type == question.Type {
+			resp.Answers = append(resp.Answers, rr)
+		}
+	}
+	s.mu.Unlock()
+
+	packed, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	if len(packed) > size {
+		resp.Answers = nil
+		resp.Truncated = true
+		if packed, err = resp.Pack(); err != nil {
+			return nil
+		}
+	}
+	return packed
+}
+
+// ownerName returns the name a policy's record is served at: SRV policies
+// are served at _service._protocol.domain.
+// served returns the visible policies for name. If there are none, the
+// policies of the closest wildcard name (e.g. *.example.com for
+// www.example.com) are returned instead. s.mu must be held.
+func (s *Server) served(name string) []unifi.DNSPolicy {
+	owner := name
+	for {
+		var policies []unifi.DNSPolicy
+		for _, policy := range s.policies {
+			if policy.Enabled && strings.EqualFold(ownerName(policy), owner) && time.Since(s.changed[policy.ID]) >= s.dnsDelay {
+				policies = append(policies, policy)
+			}
+		}
+		if len(policies) > 0 {
+			return policies
+		}
+
+		// Replace the leftmost label (and the wildcard before it) with a wildcard
+		_, parent, ok := strings.Cut(strings.TrimPrefix(owner, "*."), ".")
+		if !ok {
+			return nil
+		}
+		owner = "*." + parent
+	}
+}
+
+func ownerName(policy unifi.DNSPolicy) string {
+	if policy.Type != unifi.RecordTypeSRV {
+		return policy.Domain
+	}
+	return "_" + strings.TrimPrefix(policy.Service, "_") + "." + policy.Protocol + "." + policy.Domain
+}
+
+// policyRR converts a policy to the resource record the gateway would serve.
+func policyRR(policy unifi.DNSPolicy, name string) (dnswire.RR, bool) {
+	ttl := uint32(unifi.Deref(policy.TTLSeconds))
+
+	switch policy.Type {
+	case unifi.RecordTypeTXT:
+		rr, err := dnswire.NewTXT(name, ttl, splitTXT(policy.Text)...)
+		return rr, err == nil
+	case unifi.RecordTypeA:
+		addr, err := netip.ParseAddr(policy.IPv4Address)
+		return dnswire.NewAddress(name, ttl, addr), err == nil
+	case unifi.RecordTypeAAAA:
+		addr, err := netip.ParseAddr(policy.IPv6Address)
+		return dnswire.NewAddress(name, ttl, addr), err == nil
+	case unifi.RecordTypeCNAME:
+		rr, err := dnswire.NewCNAME(name, ttl, policy.TargetDomain)
+		return rr, err == nil
+	case unifi.RecordTypeMX:
+		rr, err := dnswire.NewMX(name, ttl, unifi.Deref(policy.Priority), policy.MailServerDomain)
+		return rr, err == nil
+	case unifi.RecordTypeSRV:
+		rr, err := dnswire.NewSRV(name, ttl, unifi.Deref(policy.Priority), unifi.Deref(policy.Weight), unifi.Deref(policy.Port), policy.ServerDomain)
+		return rr, err == nil
+	default:
+		return dnswire.RR{}, false
+	}
+}
+
+// splitTXT splits text into the character strings the gateway serves for
+// a TXT policy: consecutive chunks of at most maxTXTString bytes. Empty
+// text is served as a single empty string. Resolvers and DNS clients join
+// the strings again, so the text round-trips unchanged.
+func splitTXT(text string) []string {
+	if text == "" {
+		return []string{""}
+	}
+
+	var chunks []string
+	for len(text) > maxTXTString {
+		chunks = append(chunks, text[:maxTXTString])
+		text = text[maxTXTString:]
+	}
+	return append(chunks, text)
+}
@@ -0,0 +1,34 @@
+package unifitest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitTXT(t *testing.T) {
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{text: "", want: []int{0}},
+		{text: "short", want: []int{5}},
+		{text: strings.Repeat("a", 255), want: []int{255}},
+		{text: strings.Repeat("a", 600), want: []int{255, 255, 90}},
+	}
+
+	for _, tt := range tests {
+		chunks := splitTXT(tt.text)
+		if len(chunks) != len(tt.want) {
+			t.Errorf("splitTXT(%d bytes): expected %d strings, got %d", len(tt.text), len(tt.want), len(chunks))
+			continue
+		}
+		for i, chunk := range chunks {
+			if len(chunk) != tt.want[i] {
+				t.Errorf("splitTXT(%d bytes): string %d has %d bytes, want %d", len(tt.text), i, len(chunk), tt.want[i])
+			}
+		}
+		if strings.Join(chunks, "") != tt.text {
+			t.Errorf("splitTXT(%d bytes): strings do not join to the text", len(tt.text))
+		}
+	}
+}
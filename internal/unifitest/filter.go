@@ -0,0 +1,199 @@
+package unifitest
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// filterExpr is a parsed filter query parameter, e.g.
+// or(domain.eq('example.com'),domain.like('*.example.com')). Quotes and
+// backslashes in string values are escaped with a backslash.
+type filterExpr struct {
+	op     string
+	field  string
+	values []string
+	args   []*filterExpr
+}
+
+func (e *filterExpr) match(policy unifi.DNSPolicy) bool {
+	switch e.op {
+	case "and":
+		for _, arg := range e.args {
+			if !arg.match(policy) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, arg := range e.args {
+			if arg.match(policy) {
+				return true
+			}
+		}
+		return false
+	case "not":
+		return !e.args[0].match(policy)
+	}
+
+	value := fieldValue(policy, e.field)
+	switch e.op {
+	case "eq":
+		return e.equal(value, e.values[0])
+	case "ne":
+		return !e.equal(value, e.values[0])
+	case "in":
+		for _, v := range e.values {
+			if e.equal(value, v) {
+				return true
+			}
+		}
+		return false
+	case "like":
+		pattern := e.values[0]
+		if e.field == "domain" {
+			pattern, value = strings.ToLower(pattern), strings.ToLower(value)
+		}
+		ok, _ := path.Match(pattern, value)
+		return ok
+	}
+	return false
+}
+
+// equal compares a field value, ignoring case for domains as DNS does.
+func (e *filterExpr) equal(value, v string) bool {
+	if e.field == "domain" {
+		return strings.EqualFold(value, v)
+	}
+	return value == v
+}
+
+func fieldValue(policy unifi.DNSPolicy, field string) string {
+	switch field {
+	case "id":
+		return policy.ID
+	case "type":
+		return policy.Type
+	case "domain":
+		return policy.Domain
+	case "enabled":
+		return strconv.FormatBool(policy.Enabled)
+	}
+	return ""
+}
+
+type filterParser struct {
+	s   string
+	pos int
+}
+
+func parseFilter(s string) (*filterExpr, error) {
+	p := &filterParser{s: s}
+	expr, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.s[p.pos:], p.pos)
+	}
+	return expr, nil
+}
+
+func (p *filterParser) expr() (*filterExpr, error) {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] != '(' {
+		p.pos++
+	}
+	ident := p.s[start:p.pos]
+	if err := p.consume('('); err != nil {
+		return nil, err
+	}
+
+	switch ident {
+	case "and", "or", "not":
+		e := &filterExpr{op: ident}
+		for {
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			e.args = append(e.args, arg)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+		if ident == "not" && len(e.args) != 1 {
+			return nil, fmt.Errorf("not() takes exactly one argument")
+		}
+		return e, p.consume(')')
+	}
+
+	dot := strings.LastIndexByte(ident, '.')
+	if dot < 0 {
+		return nil, fmt.Errorf("invalid filter function %q", ident)
+	}
+	e := &filterExpr{field: ident[:dot], op: ident[dot+1:]}
+	switch e.op {
+	case "eq", "ne", "like", "in":
+	default:
+		return nil, fmt.Errorf("unsupported filter function %q", e.op)
+	}
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		e.values = append(e.values, v)
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	return e, p.consume(')')
+}
+
+func (p *filterParser) value() (string, error) {
+	if p.peek() != '\'' {
+		start := p.pos
+		for p.pos < len(p.s) && p.s[p.pos] != ',' && p.s[p.pos] != ')' {
+			p.pos++
+		}
+		return p.s[start:p.pos], nil
+	}
+	start := p.pos
+	var v strings.Builder
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		switch c := p.s[p.pos]; c {
+		case '\\':
+			p.pos++
+			if p.pos < len(p.s) {
+				v.WriteByte(p.s[p.pos])
+			}
+		case '\'':
+			p.pos++
+			return v.String(), nil
+		default:
+			v.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string at position %d", start+1)
+}
+
+func (p *filterParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *filterParser) consume(c byte) error {
+	if p.peek() != c {
+		return fmt.Errorf("expected %q at position %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
@@ -0,0 +1,350 @@
+// Package unifitest provides an in-memory fake of the UniFi Network
+// integration API's DNS policy endpoints for use in tests.
+package unifitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// DefaultAPIKey and DefaultSiteID are the credentials accepted by a Server
+// returned from NewServer.
+const (
+	DefaultAPIKey = "test-api-key"
+	DefaultSiteID = "88f7af54-98f8-306a-a1c7-c9349722b1f6"
+)
+
+// Server is a fake UniFi controller serving the DNS policy endpoints
+// of the integration API from memory.
+type Server struct {
+	*httptest.Server
+
+	// APIKey is the key expected in the X-API-KEY header.
+	APIKey string
+
+	// SiteID is the only site known to the server.
+	SiteID string
+
+	// Path is the path the integration API is served under. It defaults to
+	// the UniFi OS path; set it to "/integration/v1" to act like a
+	// standalone controller. Requests outside it get 404 Not Found.
+	Path string
+
+	mu       sync.Mutex
+	policies []unifi.DNSPolicy
+	nextID   int
+	requests int
+	throttle int
+	delay    time.Duration
+	rejected map[string]bool
+
+	changed     map[string]time.Time
+	dnsDelay    time.Duration
+	dnsConn     net.PacketConn
+	dnsListener net.Listener
+}
+
+// NewServer starts a fake controller. The caller should call Close when done.
+func NewServer() *Server {
+	return newServer(httptest.NewServer)
+}
+
+// NewTLSServer starts a fake controller serving HTTPS with a self-signed
+// certificate, like a real controller. The caller should call Close when done.
+func NewTLSServer() *Server {
+	return newServer(httptest.NewTLSServer)
+}
+
+func newServer(start func(http.Handler) *httptest.Server) *Server {
+	s := &Server{
+		APIKey: DefaultAPIKey,
+		SiteID: DefaultSiteID,
+		Path:   "/proxy/network/integration/v1",
+
+		changed:  make(map[string]time.Time),
+		rejected: make(map[string]bool),
+	}
+	s.Server = start(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// BaseURL returns the URL to use as the client's base URL.
+func (s *Server) BaseURL() string {
+	return s.URL + s.Path
+}
+
+// Policies returns a copy of all stored policies.
+func (s *Server) Policies() []unifi.DNSPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]unifi.DNSPolicy(nil), s.policies...)
+}
+
+// AddPolicy stores a policy directly, assigning it an ID, and returns it.
+func (s *Server) AddPolicy(policy unifi.DNSPolicy) unifi.DNSPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.add(policy)
+}
+
+// Requests returns the number of API requests served so far.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// SetAPIKey replaces the accepted API key, as if the key was rotated.
+func (s *Server) SetAPIKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.APIKey = key
+}
+
+// Throttle makes the server answer the next n requests with
+// 429 Too Many Requests and a Retry-After of zero seconds.
+func (s *Server) Throttle(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.throttle = n
+}
+
+// SetDelay makes the server wait d before answering each request.
+func (s *Server) SetDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delay = d
+}
+
+// Reject makes the server refuse to create policies for domain with
+// 400 Bad Request.
+func (s *Server) Reject(domain string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rejected[domain] = true
+}
+
+func (s *Server) add(policy unifi.DNSPolicy) unifi.DNSPolicy {
+	s.nextID++
+	policy.ID = fmt.Sprintf("%08d-0000-4000-8000-000000000000", s.nextID)
+	s.policies = append(s.policies, policy)
+	s.changed[policy.ID] = time.Now()
+	return policy
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	delay := s.delay
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+
+	if s.throttle > 0 {
+		s.throttle--
+		w.Header().Set("Retry-After", "0")
+		writeError(w, http.StatusTooManyRequests, "api.rate-limit.exceeded", "Too many requests")
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, s.Path+"/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Header.Get("X-API-KEY") != s.APIKey {
+		writeError(w, http.StatusUnauthorized, "api.authentication.missing-credentials", "Missing or invalid API key")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, s.Path), "/"), "/")
+	if len(parts) == 1 && parts[0] == "sites" && r.Method == http.MethodGet {
+		s.sites(w)
+		return
+	}
+	if len(parts) < 4 || parts[0] != "sites" || parts[2] != "dns" || parts[3] != "policies" {
+		writeError(w, http.StatusNotFound, "api.request.not-found", "Not found")
+		return
+	}
+	if parts[1] != s.SiteID {
+		writeError(w, http.StatusNotFound, "api.site.not-found", "Site not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 4 && r.Method == http.MethodGet:
+		s.list(w, r)
+	case len(parts) == 4 && r.Method == http.MethodPost:
+		s.create(w, r)
+	case len(parts) == 5 && r.Method == http.MethodGet:
+		s.get(w, parts[4])
+	case len(parts) == 5 && r.Method == http.MethodPut:
+		s.update(w, r, parts[4])
+	case len(parts) == 5 && r.Method == http.MethodDelete:
+		s.delete(w, parts[4])
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "api.request.method-not-allowed", "Method not allowed")
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 25
+	}
+
+	matched := make([]unifi.DNSPolicy, 0, len(s.policies))
+	if f := query.Get("filter"); f != "" {
+		expr, err := parseFilter(f)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "api.request.invalid-filter", err.Error())
+			return
+		}
+		for _, policy := range s.policies {
+			if expr.match(policy) {
+				matched = append(matched, policy)
+			}
+		}
+	} else {
+		matched = append(matched, s.policies...)
+	}
+
+	page := []unifi.DNSPolicy{}
+	if offset < len(matched) {
+		end := offset + limit
+		if end > len(matched) {
+			end = len(matched)
+		}
+		page = matched[offset:end]
+	}
+
+	writeJSON(w, http.StatusOK, unifi.ListResponse{
+		Offset:     int32(offset),
+		Limit:      int32(limit),
+		Count:      int32(len(page)),
+		TotalCount: int32(len(matched)),
+		Data:       page,
+	})
+}
+
+func (s *Server) sites(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"offset":     0,
+		"limit":      25,
+		"count":      1,
+		"totalCount": 1,
+		"data": []unifi.Site{
+			{ID: s.SiteID, InternalReference: "default", Name: "Default"},
+		},
+	})
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var policy unifi.DNSPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		writeError(w, http.StatusBadRequest, "api.request.invalid-body", err.Error())
+		return
+	}
+	if policy.Type == "" || policy.Domain == "" {
+		writeError(w, http.StatusBadRequest, "api.request.invalid-body", "type and domain are required")
+		return
+	}
+	if s.rejected[policy.Domain] {
+		writeError(w, http.StatusBadRequest, "api.request.invalid-body", "domain is rejected")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, s.add(policy))
+}
+
+func (s *Server) get(w http.ResponseWriter, id string) {
+	i := s.index(id)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "api.dns-policy.not-found", "DNS policy not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.policies[i])
+}
+
+func (s *Server) update(w http.ResponseWriter, r *http.Request, id string) {
+	i := s.index(id)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "api.dns-policy.not-found", "DNS policy not found")
+		return
+	}
+
+	var policy unifi.DNSPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		writeError(w, http.StatusBadRequest, "api.request.invalid-body", err.Error())
+		return
+	}
+	policy.ID = id
+	s.policies[i] = policy
+	s.changed[id] = time.Now()
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func (s *Server) delete(w http.ResponseWriter, id string) {
+	i := s.index(id)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "api.dns-policy.not-found", "DNS policy not found")
+		return
+	}
+	s.policies = append(s.policies[:i], s.policies[i+1:]...)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) index(id string) int {
+	for i := range s.policies {
+		if s.policies[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{
+		"statusCode": status,
+		"statusName": http.StatusText(status),
+		"code":       code,
+		"message":    message,
+	})
+}
@@ -0,0 +1,19 @@
+package unifi
+
+import (
+	"context"
+
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// Logger receives debug messages about API requests and record changes.
+// It is satisfied by *slog.Logger; args are alternating keys and values.
+// The API key is never logged.
+type Logger = unifi.Logger
+
+// debug logs msg if a Logger is configured.
+func (p *Provider) debug(ctx context.Context, msg string, args ...any) {
+	if p.Logger != nil {
+		p.Logger.DebugContext(ctx, msg, args...)
+	}
+}
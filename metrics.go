@@ -0,0 +1,43 @@
+package unifi
+
+import (
+	"github.com/libdns/libdns"
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// Metrics receives measurements of API requests and record operations.
+// See NewPrometheusMetrics for a ready-made implementation.
+type Metrics = unifi.Metrics
+
+// PrometheusMetrics collects Metrics and serves them in the Prometheus
+// text exposition format as an http.Handler.
+type PrometheusMetrics = unifi.PrometheusMetrics
+
+// NewPrometheusMetrics returns an empty PrometheusMetrics.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return unifi.NewPrometheusMetrics()
+}
+
+// observe reports the outcome of an operation on a record if Metrics is set.
+func (p *Provider) observe(operation string, record libdns.Record, err error) {
+	if p.Metrics == nil {
+		return
+	}
+
+	var recordType string
+	if record != nil {
+		recordType = record.RR().Type
+	}
+	p.Metrics.ObserveOperation(operation, recordType, err)
+}
+
+// observePolicy reports the outcome of an operation on a stored policy,
+// such as a stale record deleted by SetRecords.
+func (p *Provider) observePolicy(operation, zone string, policy unifi.DNSPolicy, err error) {
+	if p.Metrics == nil {
+		return
+	}
+
+	record, _ := unifi.PolicyToLibdns(policy, zone)
+	p.observe(operation, record, err)
+}
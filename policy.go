@@ -0,0 +1,31 @@
+package unifi
+
+import (
+	"context"
+
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// DNSPolicy is a DNS policy as stored by the controller. Fields of the
+// API's JSON that it does not declare, such as metadata added by newer
+// controller versions, are kept in its Extra map and sent back unchanged
+// when the provider updates the policy.
+type DNSPolicy = unifi.DNSPolicy
+
+// ListPolicies returns the DNS policies of the zone as stored by the
+// controller, for inspecting what GetRecords does not show, e.g. whether
+// a policy is enabled or the fields in Extra.
+func (p *Provider) ListPolicies(ctx context.Context, zone string) (policies []DNSPolicy, err error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	ctx, span := p.startSpan(ctx, "ListPolicies", zone, 0)
+	defer func() { p.endSpan(span, err) }()
+
+	client, err := p.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.listPolicies(ctx, client, zone)
+}
@@ -4,9 +4,14 @@ package unifi
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/libdns/libdns"
 	"github.com/libdns/unifi/internal/unifi"
@@ -15,7 +20,9 @@ import (
 // Provider facilitates DNS record management for Unifi Network.
 // It implements the libdns record management interfaces.
 //
-// Credentials can be set directly on the struct fields or via environment variables:
+// Credentials can be set directly on the struct fields, via environment
+// variables (UNIFI_API_KEY, UNIFI_SITE_ID and UNIFI_BASE_URL by default) or
+// in a configuration file; see LoadConfig for the order of precedence.
 type Provider struct {
 	// APIKey is the Unifi API authentication key.
 	APIKey string `json:"api_key,omitempty"`
@@ -25,26 +32,134 @@ type Provider struct {
 
 	// BaseUrl is the base URL of the Unifi controller API.
 	// Example: https://192.168.1.1/proxy/network/integration/v1
+	// A bare host such as 192.168.1.1 is accepted; https is assumed and the
+	// API path is discovered for UniFi OS consoles and standalone controllers,
+	// as is the rest of a path that does not end in /integration/v1.
 	BaseUrl string `json:"base_url,omitempty"`
 
+	// Credentials, if set, supplies the API key for every request instead of
+	// APIKey, so that a rotated key takes effect without a restart. When it
+	// is not set and the key comes from a *_FILE environment variable, the
+	// file is watched for changes in the same way.
+	Credentials Credentials `json:"-"`
+
+	// EnvPrefix is the prefix of the environment variables holding the
+	// configuration, e.g. "UNIFI_LAB_" to read UNIFI_LAB_API_KEY.
+	// Defaults to DefaultEnvPrefix.
+	EnvPrefix string `json:"env_prefix,omitempty"`
+
+	// ConfigFile is the path of a file with api_key, site_id and base_url
+	// keys: a JSON object (.json), or one key per line as "key: value"
+	// (.yaml, .yml) or key = "value" (.toml). Only such lines are accepted,
+	// not full YAML or TOML. Defaults to the CONFIG_FILE environment
+	// variable (with EnvPrefix).
+	ConfigFile string `json:"config_file,omitempty"`
+
+	// TLSVerify enables verification of the controller's certificate against
+	// the system roots. By default verification is skipped, since most
+	// controllers use self-signed certificates.
+	TLSVerify bool `json:"tls_verify,omitempty"`
+
+	// TLSCAFile is the path of a PEM file with the CA certificates to verify
+	// the controller's certificate against. Setting it implies TLSVerify.
+	TLSCAFile string `json:"tls_ca_file,omitempty"`
+
+	// HTTPClient, if set, is used to send API requests instead of a default
+	// client. Its timeout, cookie jar and redirect policy are kept, and its
+	// transport, if set, is treated like Transport.
+	HTTPClient *http.Client `json:"-"`
+
+	// Transport, if set, replaces the transport of the HTTP client, e.g. to
+	// add a proxy, a custom dialer or a recording transport for tests.
+	// An *http.Transport is cloned to apply TLSVerify and TLSCAFile, or to
+	// skip verification like the default transport if it has no TLS
+	// configuration of its own. Other transports are used as is, and
+	// TLSVerify and TLSCAFile cannot be combined with them.
+	Transport http.RoundTripper `json:"-"`
+
+	// Timeout bounds each GetRecords, AppendRecords, SetRecords and
+	// DeleteRecords call. It is not applied if the context passed to the
+	// call already has a deadline. Zero means no timeout.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// RequestTimeout bounds every single API request (each retry included).
+	// Defaults to 30 seconds.
+	RequestTimeout time.Duration `json:"request_timeout,omitempty"`
+
+	// ListTimeout bounds listing the policies of a zone, across all pages.
+	// Zero means no timeout beyond RequestTimeout for each page.
+	ListTimeout time.Duration `json:"list_timeout,omitempty"`
+
+	// CacheTTL enables caching of the policies listed for each zone for at most
+	// this long. The cache is updated after every successful change made through
+	// this provider; call Invalidate to drop it after changes made elsewhere.
+	// Zero disables caching.
+	CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+
+	// Concurrency is the maximum number of policies created, updated or
+	// deleted in parallel by a single call. Values below 2 process the
+	// records sequentially.
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// RateLimit is the maximum average number of API requests per second
+	// sent by this provider, with bursts of up to RateBurst requests.
+	// Zero disables rate limiting.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	RateBurst int     `json:"rate_burst,omitempty"`
+
+	// VerifyResolver, if set, is the address of the gateway's DNS resolver,
+	// e.g. "192.168.1.1" (port 53 by default). AppendRecords and SetRecords
+	// then query it until it serves every written record, and return the
+	// records along with a *VerifyError if it does not within VerifyTimeout.
+	VerifyResolver string `json:"verify_resolver,omitempty"`
+
+	// VerifyTimeout bounds verification. Defaults to DefaultVerifyTimeout.
+	VerifyTimeout time.Duration `json:"verify_timeout,omitempty"`
+
+	// Logger, if set, receives a debug message for every API request
+	// and every policy created, updated or deleted.
+	Logger Logger `json:"-"`
+
+	// Metrics, if set, receives measurements of every API request and
+	// record operation. See NewPrometheusMetrics.
+	Metrics Metrics `json:"-"`
+
+	// Tracer, if set, creates a span for every Provider operation and
+	// every API request made by it.
+	Tracer Tracer `json:"-"`
+
 	client *unifi.Client
+	siteID string
 	mu     sync.Mutex
+
+	cache   map[string]*policyCache
+	cacheMu sync.Mutex
 }
 
 // GetRecords lists all the records in the zone.
 // The zone parameter is not used for Unifi (all records for the site are returned).
-func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+func (p *Provider) GetRecords(ctx context.Context, zone string) (records []libdns.Record, err error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	ctx, span := p.startSpan(ctx, "GetRecords", zone, 0)
+	defer func() {
+		span.SetAttributes(Attribute{Key: "unifi.record_count", Value: len(records)})
+		p.endSpan(span, err)
+		p.observe("get", nil, err)
+	}()
+
 	client, err := p.getClient()
 	if err != nil {
 		return nil, err
 	}
 
-	policies, err := client.ListPolicies(ctx, p.SiteId, zone)
+	policies, err := p.listPolicies(ctx, client, zone)
 	if err != nil {
 		return nil, err
 	}
 
-	records := make([]libdns.Record, len(policies))
+	records = make([]libdns.Record, len(policies))
 	for i, policy := range policies {
 		record, err := unifi.PolicyToLibdns(policy, zone)
 		if err != nil {
@@ -56,176 +171,468 @@ func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record
 	return records, nil
 }
 
-// AppendRecords adds records to the zone. It returns the records that were added.
-func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+// GetRecordsByName lists the records of the zone with the given name,
+// relative to the zone, and of the given type ("A", "TXT" etc.) unless
+// recordType is empty. Only the matching policies are fetched, which is
+// much faster than GetRecords on a large zone. The name of SRV records
+// includes the service and protocol, e.g. "_sip._tcp.voip".
+func (p *Provider) GetRecordsByName(ctx context.Context, zone, name, recordType string) (records []libdns.Record, err error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	ctx, span := p.startSpan(ctx, "GetRecordsByName", zone, 0)
+	defer func() {
+		span.SetAttributes(Attribute{Key: "unifi.record_count", Value: len(records)})
+		p.endSpan(span, err)
+		p.observe("get", nil, err)
+	}()
+
+	var policyType string
+	if recordType != "" {
+		policyType, err = unifi.PolicyType(recordType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	client, err := p.getClient()
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]libdns.Record, 0, len(records))
+	var policies []unifi.DNSPolicy
+	service, transport, rest, isSRV := unifi.SplitSRVName(name)
+	if !isSRV || policyType != unifi.RecordTypeSRV {
+		domain, err := unifi.PolicyDomain(name, zone)
+		if err != nil {
+			return nil, err
+		}
+		policies, err = client.FindPolicies(ctx, p.siteID, domain, policyType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// SRV policies are stored under the name without the service and
+	// protocol labels, which are fields of their own
+	if isSRV && (policyType == "" || policyType == unifi.RecordTypeSRV) {
+		domain, err := unifi.PolicyDomain(rest, zone)
+		if err != nil {
+			return nil, err
+		}
+		srv, err := client.FindPolicies(ctx, p.siteID, domain, unifi.RecordTypeSRV)
+		if err != nil {
+			return nil, err
+		}
+		for _, policy := range srv {
+			if strings.EqualFold(strings.TrimPrefix(policy.Service, "_"), service) &&
+				strings.EqualFold(strings.TrimPrefix(policy.Protocol, "_"), transport) {
+				policies = append(policies, policy)
+			}
+		}
+	}
+
+	records = make([]libdns.Record, len(policies))
+	for i, policy := range policies {
+		record, err := unifi.PolicyToLibdns(policy, zone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert policy to libdns record: %w", err)
+		}
+		records[i] = record
+	}
+
+	return records, nil
+}
+
+// AppendRecords adds records to the zone. It returns the records that were added,
+// also when some of them fail.
+func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	ctx, span := p.startSpan(ctx, "AppendRecords", zone, len(records))
+	defer func() { p.endSpan(span, err) }()
 
-	for _, record := range records {
-		policy, err := unifi.LibdnsToPolicy(record, zone)
+	client, err := p.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]unifi.DNSPolicy, len(records))
+	for i, record := range records {
+		policies[i], err = unifi.LibdnsToPolicy(record, zone)
 		if err != nil {
+			p.observe("append", record, err)
 			return nil, fmt.Errorf("failed to convert record to policy: %w", err)
 		}
+	}
+
+	result := make([]libdns.Record, len(records))
 
-		created, err := client.CreatePolicy(ctx, p.SiteId, policy)
+	err = p.forEach(ctx, len(policies), func(ctx context.Context, i int) (err error) {
+		defer func() { p.observe("append", records[i], err) }()
+
+		created, err := client.CreatePolicy(ctx, p.siteID, policies[i])
 		if err != nil {
-			return nil, fmt.Errorf("failed to create DNS policy: %w", err)
+			return fmt.Errorf("failed to create DNS policy: %w", err)
 		}
+		p.cachePut(zone, created)
+		p.debug(ctx, "created DNS policy", "zone", zone, "policy_id", created.ID, "domain", created.Domain, "type", created.Type)
 
-		createdRecord, err := unifi.PolicyToLibdns(created, zone)
+		result[i], err = unifi.PolicyToLibdns(created, zone)
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert created policy to libdns record: %w", err)
+			return fmt.Errorf("failed to convert created policy to libdns record: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return completed(result), err
+	}
 
-		result = append(result, createdRecord)
+	if err := p.verify(ctx, zone, records); err != nil {
+		return result, err
 	}
 
 	return result, nil
 }
 
 // SetRecords sets the records in the zone, either by updating existing records or creating new ones.
-// It returns the updated records.
-func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+// For every name and type in the input, existing records that are not part of the input are deleted.
+// It returns the updated records, also when some of them fail.
+func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	ctx, span := p.startSpan(ctx, "SetRecords", zone, len(records))
+	defer func() { p.endSpan(span, err) }()
+
 	client, err := p.getClient()
 	if err != nil {
 		return nil, err
 	}
 
+	policies := make([]unifi.DNSPolicy, len(records))
+	for i, record := range records {
+		policies[i], err = unifi.LibdnsToPolicy(record, zone)
+		if err != nil {
+			p.observe("set", record, err)
+			return nil, fmt.Errorf("failed to convert record to policy: %w", err)
+		}
+	}
+
 	// Get existing records to match them with incoming records
-	existing, err := client.ListPolicies(ctx, p.SiteId, zone)
+	existing, err := p.existingPolicies(ctx, client, zone, policies)
 	if err != nil {
+		for _, record := range records {
+			p.observe("set", record, err)
+		}
 		return nil, fmt.Errorf("failed to list existing policies: %w", err)
 	}
 
-	result := make([]libdns.Record, 0, len(records))
+	updateIDs := make([]string, len(records))
+	claimed := make(map[string]bool, len(records))
+	rrsets := make(map[string]bool, len(records))
 
-	for _, record := range records {
-		policy, err := unifi.LibdnsToPolicy(record, zone)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert record to policy: %w", err)
-		}
+	for i, policy := range policies {
+		rrsets[rrsetKey(policy)] = true
 
-		// Find existing record by domain name
-		var existingPolicy *unifi.DNSPolicy
-		for i := range existing {
-			if existing[i].Domain == policy.Domain {
-				existingPolicy = &existing[i]
-				break
-			}
+		// Prefer an identical existing record, then any other one with the same name and type
+		existingPolicy := findPolicy(existing, claimed, func(e unifi.DNSPolicy) bool {
+			return matchPolicy(e, policy)
+		})
+		if existingPolicy == nil {
+			existingPolicy = findPolicy(existing, claimed, func(e unifi.DNSPolicy) bool {
+				return rrsetKey(e) == rrsetKey(policy)
+			})
+		}
+		if existingPolicy != nil {
+			claimed[existingPolicy.ID] = true
+			updateIDs[i] = existingPolicy.ID
 		}
+	}
+
+	result := make([]libdns.Record, len(records))
+
+	err = p.forEach(ctx, len(policies), func(ctx context.Context, i int) (err error) {
+		defer func() { p.observe("set", records[i], err) }()
 
 		var result_policy unifi.DNSPolicy
 		var setErr error
 
-		if existingPolicy != nil {
-			// Update existing policy
-			result_policy, setErr = client.UpdatePolicy(ctx, p.SiteId, existingPolicy.ID, policy)
+		if updateIDs[i] != "" {
+			// Update existing policy, keeping the fields the record does not set
+			result_policy, setErr = client.PatchPolicy(ctx, p.siteID, updateIDs[i], policies[i])
 			if setErr != nil {
-				return nil, fmt.Errorf("failed to update DNS policy: %w", setErr)
+				return fmt.Errorf("failed to update DNS policy: %w", setErr)
 			}
+			p.debug(ctx, "updated DNS policy", "zone", zone, "policy_id", result_policy.ID, "domain", result_policy.Domain, "type", result_policy.Type)
 		} else {
 			// Create new policy
-			result_policy, setErr = client.CreatePolicy(ctx, p.SiteId, policy)
+			result_policy, setErr = client.CreatePolicy(ctx, p.siteID, policies[i])
 			if setErr != nil {
-				return nil, fmt.Errorf("failed to create DNS policy: %w", setErr)
+				return fmt.Errorf("failed to create DNS policy: %w", setErr)
 			}
+			p.debug(ctx, "created DNS policy", "zone", zone, "policy_id", result_policy.ID, "domain", result_policy.Domain, "type", result_policy.Type)
 		}
+		p.cachePut(zone, result_policy)
 
-		createdRecord, err := unifi.PolicyToLibdns(result_policy, zone)
+		result[i], err = unifi.PolicyToLibdns(result_policy, zone)
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert policy to libdns record: %w", err)
+			return fmt.Errorf("failed to convert policy to libdns record: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return completed(result), err
+	}
 
-		result = append(result, createdRecord)
+	// Remove the records of each set name and type that were not in the input
+	var stale []unifi.DNSPolicy
+	for _, policy := range existing {
+		if !claimed[policy.ID] && rrsets[rrsetKey(policy)] {
+			stale = append(stale, policy)
+		}
+	}
+
+	err = p.forEach(ctx, len(stale), func(ctx context.Context, i int) (err error) {
+		defer func() { p.observePolicy("delete", zone, stale[i], err) }()
+
+		if err := client.DeletePolicy(ctx, p.siteID, stale[i].ID); err != nil {
+			return fmt.Errorf("failed to delete DNS policy: %w", err)
+		}
+		p.cacheRemove(zone, stale[i])
+		p.debug(ctx, "deleted DNS policy", "zone", zone, "policy_id", stale[i].ID, "domain", stale[i].Domain, "type", stale[i].Type)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if err := p.verify(ctx, zone, records); err != nil {
+		return result, err
 	}
 
 	return result, nil
 }
 
-// DeleteRecords deletes the specified records from the zone and returns the deleted records.
-func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+// DeleteRecords deletes the specified records from the zone and returns the deleted records,
+// also when some of them fail.
+func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	ctx, span := p.startSpan(ctx, "DeleteRecords", zone, len(records))
+	defer func() { p.endSpan(span, err) }()
+
 	client, err := p.getClient()
 	if err != nil {
 		return nil, err
 	}
 
+	policies := make([]unifi.DNSPolicy, len(records))
+	for i, record := range records {
+		policies[i], err = unifi.LibdnsToPolicy(record, zone)
+		if err != nil {
+			p.observe("delete", record, err)
+			return nil, fmt.Errorf("failed to convert record to policy: %w", err)
+		}
+	}
+
 	// Get existing records to find IDs for deletion
-	existing, err := client.ListPolicies(ctx, p.SiteId, zone)
+	existing, err := p.existingPolicies(ctx, client, zone, policies)
 	if err != nil {
+		for _, record := range records {
+			p.observe("delete", record, err)
+		}
 		return nil, fmt.Errorf("failed to list existing policies: %w", err)
 	}
 
-	result := make([]libdns.Record, 0, len(records))
-
-	for _, record := range records {
-		policy, err := unifi.LibdnsToPolicy(record, zone)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert record to policy: %w", err)
-		}
+	var toDelete []unifi.DNSPolicy
+	var deleteRecords []libdns.Record
+	deleted := make(map[string]bool, len(records))
 
-		// Find existing record by domain name
-		var existingPolicy *unifi.DNSPolicy
-		for i := range existing {
-			if existing[i].Domain == policy.Domain {
-				existingPolicy = &existing[i]
-				break
-			}
-		}
+	for i, policy := range policies {
+		// Find an existing record with the same name, type and value
+		// that has not already been deleted by this call
+		existingPolicy := findPolicy(existing, deleted, func(e unifi.DNSPolicy) bool {
+			return matchPolicy(e, policy)
+		})
 
 		if existingPolicy == nil {
 			continue
 		}
+		deleted[existingPolicy.ID] = true
+		toDelete = append(toDelete, *existingPolicy)
+		deleteRecords = append(deleteRecords, records[i])
+	}
+
+	result := make([]libdns.Record, len(toDelete))
 
-		if err := client.DeletePolicy(ctx, p.SiteId, existingPolicy.ID); err != nil {
-			return nil, fmt.Errorf("failed to delete DNS policy: %w", err)
+	err = p.forEach(ctx, len(toDelete), func(ctx context.Context, i int) (err error) {
+		defer func() { p.observe("delete", deleteRecords[i], err) }()
+
+		if err := client.DeletePolicy(ctx, p.siteID, toDelete[i].ID); err != nil {
+			return fmt.Errorf("failed to delete DNS policy: %w", err)
 		}
+		p.cacheRemove(zone, toDelete[i])
+		p.debug(ctx, "deleted DNS policy", "zone", zone, "policy_id", toDelete[i].ID, "domain", toDelete[i].Domain, "type", toDelete[i].Type)
 
-		deleteResult, err := unifi.PolicyToLibdns(*existingPolicy, zone)
+		result[i], err = unifi.PolicyToLibdns(toDelete[i], zone)
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert policy to libdns record: %w", err)
+			return fmt.Errorf("failed to convert policy to libdns record: %w", err)
 		}
-
-		result = append(result, deleteResult)
+		return nil
+	})
+	if err != nil {
+		return completed(result), err
 	}
 
 	return result, nil
 }
 
+// withTimeout applies Timeout to ctx, unless ctx already has a deadline.
+func (p *Provider) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || p.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.Timeout)
+}
+
+// matchPolicy reports whether the existing policy has the same domain, type
+// and record data as the wanted one. TTL and the enabled flag are ignored.
+func matchPolicy(existing, wanted unifi.DNSPolicy) bool {
+	return unifi.SameName(existing.Domain, wanted.Domain) &&
+		existing.Type == wanted.Type &&
+		existing.IPv4Address == wanted.IPv4Address &&
+		existing.IPv6Address == wanted.IPv6Address &&
+		existing.TargetDomain == wanted.TargetDomain &&
+		unifi.JoinTXTStrings(existing.Text) == unifi.JoinTXTStrings(wanted.Text) &&
+		existing.MailServerDomain == wanted.MailServerDomain &&
+		existing.ServerDomain == wanted.ServerDomain &&
+		existing.Service == wanted.Service &&
+		existing.Protocol == wanted.Protocol &&
+		unifi.Deref(existing.Port) == unifi.Deref(wanted.Port) &&
+		unifi.Deref(existing.Weight) == unifi.Deref(wanted.Weight) &&
+		unifi.Deref(existing.Priority) == unifi.Deref(wanted.Priority)
+}
+
+// rrsetKey identifies the set of records a policy belongs to,
+// i.e. its name and type (and service and protocol for SRV records).
+func rrsetKey(policy unifi.DNSPolicy) string {
+	key := policy.Type + " " + strings.ToLower(policy.Domain)
+	if policy.Type == unifi.RecordTypeSRV {
+		key += " " + policy.Service + " " + policy.Protocol
+	}
+	return key
+}
+
+// existingPolicies returns the stored policies that policies may match.
+// Without a cache, policies of a single domain are looked up by that domain
+// instead of listing the whole zone.
+func (p *Provider) existingPolicies(ctx context.Context, client *unifi.Client, zone string, policies []unifi.DNSPolicy) ([]unifi.DNSPolicy, error) {
+	if p.CacheTTL > 0 || len(policies) == 0 {
+		return p.listPolicies(ctx, client, zone)
+	}
+	for _, policy := range policies[1:] {
+		if !unifi.SameName(policy.Domain, policies[0].Domain) {
+			return p.listPolicies(ctx, client, zone)
+		}
+	}
+	return client.FindPolicies(ctx, p.siteID, policies[0].Domain, "")
+}
+
+// findPolicy returns the first policy not in claimed that satisfies match, or nil.
+func findPolicy(policies []unifi.DNSPolicy, claimed map[string]bool, match func(unifi.DNSPolicy) bool) *unifi.DNSPolicy {
+	for i := range policies {
+		if !claimed[policies[i].ID] && match(policies[i]) {
+			return &policies[i]
+		}
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS configuration verifying the controller's
+// certificate against TLSCAFile, or the system roots if it is empty. It
+// returns nil if neither TLSVerify nor TLSCAFile is set, and an error if
+// they are set along with a transport of the caller's that is not an
+// *http.Transport, which is used as is.
+func (p *Provider) tlsConfig() (*tls.Config, error) {
+	if !p.TLSVerify && p.TLSCAFile == "" {
+		return nil, nil
+	}
+	transport := p.Transport
+	if transport == nil && p.HTTPClient != nil {
+		transport = p.HTTPClient.Transport
+	}
+	if _, ok := transport.(*http.Transport); transport != nil && !ok {
+		return nil, fmt.Errorf("TLSVerify and TLSCAFile cannot be combined with a custom transport other than *http.Transport; configure TLS on the transport instead")
+	}
+
+	cfg := &tls.Config{}
+	if p.TLSCAFile == "" {
+		return cfg, nil
+	}
+
+	pem, err := os.ReadFile(p.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	cfg.RootCAs = x509.NewCertPool()
+	if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", p.TLSCAFile)
+	}
+
+	return cfg, nil
+}
+
 // getClient initializes and returns the API client.
 func (p *Provider) getClient() (*unifi.Client, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	if p.client == nil {
-		apiKey := p.APIKey
-		if apiKey == "" {
-			apiKey = os.Getenv("UNIFI_API_KEY")
-		}
-		if apiKey == "" {
-			return nil, fmt.Errorf("API key is required (set APIKey field or UNIFI_API_KEY env var)")
+		cfg, err := p.LoadConfig()
+		if err != nil {
+			return nil, err
 		}
 
-		siteID := p.SiteId
-		if siteID == "" {
-			siteID = os.Getenv("UNIFI_SITE_ID")
+		opts := []unifi.Option{
+			unifi.WithRateLimit(p.RateLimit, p.RateBurst),
+			unifi.WithLogger(p.Logger),
+			unifi.WithMetrics(p.Metrics),
+			unifi.WithTracer(p.Tracer),
 		}
-		if siteID == "" {
-			return nil, fmt.Errorf("site ID is required (set SiteId field or UNIFI_SITE_ID env var)")
+		if p.RequestTimeout > 0 {
+			opts = append(opts, unifi.WithRequestTimeout(p.RequestTimeout))
+		}
+		if p.ListTimeout > 0 {
+			opts = append(opts, unifi.WithListTimeout(p.ListTimeout))
+		}
+		if p.HTTPClient != nil {
+			opts = append(opts, unifi.WithHTTPClient(p.HTTPClient))
+		}
+		if p.Transport != nil {
+			opts = append(opts, unifi.WithTransport(p.Transport))
+		}
+		tlsConfig, err := p.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig != nil {
+			opts = append(opts, unifi.WithTLSConfig(tlsConfig))
 		}
 
-		baseURL := p.BaseUrl
-		if baseURL == "" {
-			baseURL = os.Getenv("UNIFI_BASE_URL")
+		baseURL, err := unifi.NormalizeBaseURL(cfg.BaseURL.Value)
+		if err != nil {
+			return nil, err
 		}
-		if baseURL == "" {
-			return nil, fmt.Errorf("base URL is required (set BaseUrl field or UNIFI_BASE_URL env var)")
+
+		if creds := p.credentials(cfg.APIKey); creds != nil {
+			opts = append(opts, unifi.WithCredentials(creds))
 		}
 
-		p.client = unifi.NewClient(apiKey, baseURL)
+		p.client = unifi.NewClient(cfg.APIKey.Value, baseURL, opts...)
+		p.siteID = cfg.SiteID.Value
 	}
 
 	return p.client, nil
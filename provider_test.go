@@ -2,15 +2,29 @@ package unifi_test
 
 import (
 	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"net/netip"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/libdns/libdns"
 	"github.com/libdns/unifi"
+	"github.com/libdns/unifi/internal/dnswire"
+	api "github.com/libdns/unifi/internal/unifi"
+	"github.com/libdns/unifi/internal/unifitest"
 )
 
 var (
@@ -54,6 +68,22 @@ func setup(t *testing.T) (*unifi.Provider, context.Context) {
 	return provider, ctx
 }
 
+// setupFake starts a fake controller, closed when the test ends, and returns
+// it with a provider using it. Tests set further provider fields as needed.
+func setupFake(t *testing.T) (*unifitest.Server, *unifi.Provider, context.Context) {
+	t.Helper()
+
+	fake := unifitest.NewServer()
+	t.Cleanup(fake.Close)
+
+	provider := &unifi.Provider{
+		APIKey:  fake.APIKey,
+		SiteId:  fake.SiteID,
+		BaseUrl: fake.BaseURL(),
+	}
+	return fake, provider, context.Background()
+}
+
 // TestGetRecords tests reading DNS records
 func TestGetRecords(t *testing.T) {
 	provider, ctx := setup(t)
@@ -664,6 +694,1728 @@ func TestMixedRecordTypes(t *testing.T) {
 	}
 }
 
+// TestSetRecordsReplacesRecordSet tests that SetRecords leaves exactly the given
+// records for each name and type in the input, and nothing else is touched
+func TestSetRecordsReplacesRecordSet(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+
+	if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.3")},
+		libdns.TXT{Name: "www", Text: "keep"},
+		libdns.Address{Name: "mail", IP: netip.MustParseAddr("192.0.2.9")},
+	}); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	before := make(map[string]string)
+	for _, policy := range fake.Policies() {
+		before[policy.IPv4Address+policy.Text] = policy.ID
+	}
+
+	got, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.4")},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("Expected 2 records, got %v", got)
+	}
+
+	after := make(map[string]string)
+	for _, policy := range fake.Policies() {
+		after[policy.Domain+" "+policy.IPv4Address+policy.Text] = policy.ID
+	}
+	want := []string{
+		"www.example.com 192.0.2.2",
+		"www.example.com 192.0.2.4",
+		"www.example.com keep",
+		"mail.example.com 192.0.2.9",
+	}
+	if len(after) != len(want) {
+		t.Errorf("Expected policies %v, got %v", want, after)
+	}
+	for _, key := range want {
+		if _, ok := after[key]; !ok {
+			t.Errorf("Expected policy %s, got %v", key, after)
+		}
+	}
+
+	// The identical record keeps its policy, another one of the set is reused
+	if after["www.example.com 192.0.2.2"] != before["192.0.2.2"] {
+		t.Error("Expected the unchanged record to keep its policy")
+	}
+	if id := after["www.example.com 192.0.2.4"]; id != before["192.0.2.1"] && id != before["192.0.2.3"] {
+		t.Error("Expected the new record to reuse a policy of the same name and type")
+	}
+}
+
+// TestCache tests that cached policies are reused and kept up to date by writes
+func TestCache(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	provider.CacheTTL = time.Minute
+
+	records := []libdns.Record{
+		libdns.Address{Name: "a", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+		libdns.Address{Name: "b", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Hour},
+	}
+	if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if _, err := provider.AppendRecords(ctx, "example.com", records); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	if _, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "a", IP: netip.MustParseAddr("192.0.2.10"), TTL: time.Hour},
+	}); err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+	if _, err := provider.DeleteRecords(ctx, "example.com", records[1:]); err != nil {
+		t.Fatalf("DeleteRecords failed: %v", err)
+	}
+
+	// 1 list, 2 creates, 1 read and update, and 1 delete
+	if got := fake.Requests(); got != 6 {
+		t.Errorf("Expected 6 API requests, got %d", got)
+	}
+
+	got, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if len(got) != 1 || got[0].(libdns.Address).IP.String() != "192.0.2.10" {
+		t.Errorf("Unexpected cached records: %v", got)
+	}
+	if got := fake.Requests(); got != 6 {
+		t.Errorf("Expected cached GetRecords to make no request, got %d requests", got)
+	}
+
+	// A change made elsewhere is only visible after invalidation
+	fake.AddPolicy(api.DNSPolicy{
+		Type:        api.RecordTypeA,
+		Domain:      "c.example.com",
+		IPv4Address: "192.0.2.3",
+		Enabled:     true,
+	})
+	if got, _ := provider.GetRecords(ctx, "example.com"); len(got) != 1 {
+		t.Errorf("Expected 1 cached record, got %d", len(got))
+	}
+	provider.Invalidate("example.com")
+	if got, _ := provider.GetRecords(ctx, "example.com"); len(got) != 2 {
+		t.Errorf("Expected 2 records after Invalidate, got %d", len(got))
+	}
+}
+
+// TestCacheReturnsCopies tests that changing listed policies does not change the cache
+func TestCacheReturnsCopies(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	provider.CacheTTL = time.Minute
+
+	fake.AddPolicy(api.DNSPolicy{
+		Type:        api.RecordTypeA,
+		Domain:      "www.example.com",
+		IPv4Address: "192.0.2.1",
+		TTLSeconds:  api.Ptr(int32(300)),
+		Enabled:     true,
+		Extra:       map[string]json.RawMessage{"metadata": json.RawMessage(`{"origin":"ui"}`)},
+	})
+
+	for i := 0; i < 2; i++ {
+		policies, err := provider.ListPolicies(ctx, "example.com")
+		if err != nil {
+			t.Fatalf("ListPolicies failed: %v", err)
+		}
+		if len(policies) != 1 {
+			t.Fatalf("Expected 1 policy, got %d", len(policies))
+		}
+		if got := string(policies[0].Extra["metadata"]); got != `{"origin":"ui"}` {
+			t.Errorf("List %d: expected the stored metadata, got %q", i+1, got)
+		}
+		if got := api.Deref(policies[0].TTLSeconds); got != 300 {
+			t.Errorf("List %d: expected TTL 300, got %d", i+1, got)
+		}
+
+		policies[0].Extra["metadata"][2] = 'X'
+		policies[0].Extra["added"] = json.RawMessage(`true`)
+		*policies[0].TTLSeconds = 1
+	}
+	if got := fake.Requests(); got != 1 {
+		t.Errorf("Expected the second list to be cached, got %d requests", got)
+	}
+}
+
+// TestConcurrentAppend tests that parallel creates return results in input order
+// and that throttled requests are retried
+func TestConcurrentAppend(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	provider.Concurrency = 8
+
+	var records []libdns.Record
+	for i := 0; i < 50; i++ {
+		records = append(records, libdns.Address{
+			Name: fmt.Sprintf("host-%02d", i),
+			IP:   netip.AddrFrom4([4]byte{192, 0, 2, byte(i)}),
+			TTL:  time.Hour,
+		})
+	}
+
+	fake.Throttle(5)
+
+	created, err := provider.AppendRecords(ctx, "example.com", records)
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	if len(created) != len(records) {
+		t.Fatalf("Expected %d created records, got %d", len(records), len(created))
+	}
+	for i, record := range created {
+		if got, want := record.RR().Name, records[i].RR().Name; got != want {
+			t.Errorf("Result %d: expected %s, got %s", i, want, got)
+		}
+	}
+
+	deleted, err := provider.DeleteRecords(ctx, "example.com", records)
+	if err != nil {
+		t.Fatalf("DeleteRecords failed: %v", err)
+	}
+	if len(deleted) != len(records) {
+		t.Errorf("Expected %d deleted records, got %d", len(records), len(deleted))
+	}
+	if got := len(fake.Policies()); got != 0 {
+		t.Errorf("Expected no policies left, got %d", got)
+	}
+}
+
+// TestBatchErrorUnwrap tests that the API errors inside a BatchError can be found
+func TestBatchErrorUnwrap(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	provider.SiteId = "unknown-site"
+	provider.Concurrency = 2
+	// Keep both requests in flight so that both fail
+	fake.SetDelay(50 * time.Millisecond)
+
+	_, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "a", IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.Address{Name: "b", IP: netip.MustParseAddr("192.0.2.2")},
+	})
+
+	var batchErr *unifi.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 {
+		t.Fatalf("Expected a BatchError of 2 errors, got %v", err)
+	}
+
+	// Through errors.As, and through the methods used before Go 1.20
+	var apiErr *unifi.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 APIError, got %v", err)
+	}
+	apiErr = nil
+	if !batchErr.As(&apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected BatchError.As to find a 404 APIError, got %v", apiErr)
+	}
+	if !batchErr.Is(batchErr.Errors[1]) || batchErr.Is(context.Canceled) {
+		t.Error("Expected BatchError.Is to match its individual errors only")
+	}
+}
+
+// TestPartialFailure tests that the records written before a failure are returned
+// with the error and that no call starts after it
+func TestPartialFailure(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	fake.Reject("b.example.com")
+
+	records := []libdns.Record{
+		libdns.Address{Name: "a", IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.Address{Name: "b", IP: netip.MustParseAddr("192.0.2.2")},
+		libdns.Address{Name: "c", IP: netip.MustParseAddr("192.0.2.3")},
+	}
+
+	for i := 0; i < 20; i++ {
+		created, err := provider.AppendRecords(ctx, "example.com", records)
+		var apiErr *unifi.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected a 400 APIError, got %v", err)
+		}
+		if len(created) != 1 || created[0].RR().Name != "a" {
+			t.Fatalf("Expected only the record a to be returned, got %v", created)
+		}
+
+		deleted, err := provider.DeleteRecords(ctx, "example.com", records)
+		if err != nil {
+			t.Fatalf("DeleteRecords failed: %v", err)
+		}
+		if len(deleted) != 1 {
+			t.Fatalf("Expected c never to be created, got %d policies", len(deleted))
+		}
+	}
+}
+
+// recordingLogger keeps every logged message with its arguments
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []map[string]any
+}
+
+func (l *recordingLogger) DebugContext(ctx context.Context, msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := map[string]any{"msg": msg}
+	for i := 0; i+1 < len(args); i += 2 {
+		entry[fmt.Sprint(args[i])] = args[i+1]
+	}
+	l.entries = append(l.entries, entry)
+}
+
+// TestLogger tests that API requests and record changes are logged without the API key
+func TestLogger(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	logger := &recordingLogger{}
+	provider.Logger = logger
+
+	records := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+	}
+	created, err := provider.AppendRecords(ctx, "example.com", records)
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	fake.Throttle(1)
+	if _, err := provider.DeleteRecords(ctx, "example.com", created); err != nil {
+		t.Fatalf("DeleteRecords failed: %v", err)
+	}
+
+	var requests []map[string]any
+	for _, entry := range logger.entries {
+		if strings.Contains(fmt.Sprint(entry), fake.APIKey) {
+			t.Errorf("API key leaked into log entry %v", entry)
+		}
+		if entry["msg"] == "unifi api request" {
+			requests = append(requests, entry)
+		}
+	}
+
+	// create, list (throttled once) and delete
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 logged requests, got %d: %v", len(requests), logger.entries)
+	}
+	if requests[0]["method"] != "POST" || requests[0]["status"] != 201 {
+		t.Errorf("Unexpected create request entry: %v", requests[0])
+	}
+	if requests[1]["method"] != "GET" || requests[1]["retries"] != 1 {
+		t.Errorf("Unexpected list request entry: %v", requests[1])
+	}
+	if requests[2]["method"] != "DELETE" || requests[2]["policy_id"] == nil {
+		t.Errorf("Unexpected delete request entry: %v", requests[2])
+	}
+}
+
+// TestPrometheusMetrics tests that requests and operations are exposed in the text format
+func TestPrometheusMetrics(t *testing.T) {
+	_, provider, ctx := setupFake(t)
+	metrics := unifi.NewPrometheusMetrics()
+	provider.Metrics = metrics
+
+	records := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+		libdns.TXT{Name: "www", Text: "hello"},
+	}
+	created, err := provider.AppendRecords(ctx, "example.com", records)
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	if _, err := provider.DeleteRecords(ctx, "example.com", created[:1]); err != nil {
+		t.Fatalf("DeleteRecords failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		`unifi_api_requests_total{method="POST",endpoint="/sites/{siteId}/dns/policies",status="201"} 2`,
+		`unifi_api_requests_total{method="GET",endpoint="/sites/{siteId}/dns/policies",status="200"} 1`,
+		`unifi_api_requests_total{method="DELETE",endpoint="/sites/{siteId}/dns/policies/{policyId}",status="200"} 1`,
+		`unifi_api_request_duration_seconds_count{method="POST",endpoint="/sites/{siteId}/dns/policies"} 2`,
+		`unifi_api_request_duration_seconds_bucket{method="POST",endpoint="/sites/{siteId}/dns/policies",le="+Inf"} 2`,
+		`unifi_record_operations_total{operation="append",type="A",result="success"} 1`,
+		`unifi_record_operations_total{operation="append",type="TXT",result="success"} 1`,
+		`unifi_record_operations_total{operation="delete",type="A",result="success"} 1`,
+		"# TYPE unifi_api_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+}
+
+// TestSetRecordsMetrics tests that the deletions of a shrinking record set and
+// failed listings are counted as operations
+func TestSetRecordsMetrics(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	metrics := unifi.NewPrometheusMetrics()
+	provider.Metrics = metrics
+
+	if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.3")},
+	}); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	if _, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+	}); err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+
+	// A listing that fails counts against every input record
+	broken := &unifi.Provider{
+		APIKey:  fake.APIKey,
+		SiteId:  "unknown-site",
+		BaseUrl: fake.BaseURL(),
+		Metrics: metrics,
+	}
+	if _, err := broken.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.TXT{Name: "www", Text: "hello"},
+	}); err == nil {
+		t.Fatal("Expected SetRecords to fail for an unknown site")
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		`unifi_record_operations_total{operation="set",type="A",result="success"} 1`,
+		`unifi_record_operations_total{operation="delete",type="A",result="success"} 2`,
+		`unifi_record_operations_total{operation="set",type="TXT",result="error"} 1`,
+		`unifi_api_requests_total{method="DELETE",endpoint="/sites/{siteId}/dns/policies/{policyId}",status="200"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+}
+
+type spanKey struct{}
+
+// recordingTracer keeps every started span
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	name   string
+	parent *recordingSpan
+	attrs  map[string]any
+	err    error
+	ended  bool
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, unifi.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parent, _ := ctx.Value(spanKey{}).(*recordingSpan)
+	span := &recordingSpan{name: name, parent: parent, attrs: map[string]any{}}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...unifi.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) { s.err = err }
+func (s *recordingSpan) End()                  { s.ended = true }
+
+// TestTracer tests that Provider operations and their API requests are traced
+func TestTracer(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	tracer := &recordingTracer{}
+	provider.Tracer = tracer
+
+	records := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+	}
+	if _, err := provider.AppendRecords(ctx, "example.com", records); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(tracer.spans))
+	}
+
+	op, req := tracer.spans[0], tracer.spans[1]
+	if op.name != "unifi.AppendRecords" || !op.ended {
+		t.Errorf("Unexpected operation span %q (ended: %v)", op.name, op.ended)
+	}
+	if op.attrs["unifi.zone"] != "example.com" || op.attrs["unifi.site_id"] != fake.SiteID || op.attrs["unifi.record_count"] != 1 {
+		t.Errorf("Unexpected operation span attributes: %v", op.attrs)
+	}
+
+	if req.name != "unifi.http.request" || req.parent != op || !req.ended {
+		t.Errorf("Expected an ended request span below the operation span, got %q", req.name)
+	}
+	if req.attrs["http.request.method"] != "POST" || req.attrs["http.response.status_code"] != 201 {
+		t.Errorf("Unexpected request span attributes: %v", req.attrs)
+	}
+
+	// A failed request records its error on both spans
+	provider = &unifi.Provider{
+		APIKey:  "wrong",
+		SiteId:  fake.SiteID,
+		BaseUrl: fake.BaseURL(),
+		Tracer:  tracer,
+	}
+	if _, err := provider.GetRecords(ctx, "example.com"); err == nil {
+		t.Fatal("Expected GetRecords to fail")
+	}
+	for _, span := range tracer.spans[2:] {
+		if span.err == nil {
+			t.Errorf("Expected span %q to record the error", span.name)
+		}
+	}
+}
+
+// countingTransport counts the requests passing through it
+type countingTransport struct {
+	base  http.RoundTripper
+	count int64
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.count, 1)
+	return t.base.RoundTrip(req)
+}
+
+// TestTransport tests that a custom RoundTripper is used for API requests
+func TestTransport(t *testing.T) {
+	_, provider, ctx := setupFake(t)
+	transport := &countingTransport{base: http.DefaultTransport}
+	provider.Transport = transport
+
+	if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if got := atomic.LoadInt64(&transport.count); got != 1 {
+		t.Errorf("Expected 1 request through the transport, got %d", got)
+	}
+}
+
+// TestTLSOptions tests certificate verification against self-signed controllers
+func TestTLSOptions(t *testing.T) {
+	fake := unifitest.NewTLSServer()
+	defer fake.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: fake.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(p *unifi.Provider)
+		wantErr bool
+	}{
+		{name: "skip verification by default", setup: func(p *unifi.Provider) {}},
+		{name: "verify against system roots", setup: func(p *unifi.Provider) { p.TLSVerify = true }, wantErr: true},
+		{name: "verify against CA file", setup: func(p *unifi.Provider) { p.TLSCAFile = caFile }},
+		{name: "default TLS on custom HTTP client", setup: func(p *unifi.Provider) { p.HTTPClient = &http.Client{} }},
+		{name: "transport with own TLS config", setup: func(p *unifi.Provider) { p.Transport = fake.Client().Transport }},
+		{name: "client with own transport", setup: func(p *unifi.Provider) { p.HTTPClient = fake.Client() }},
+		{name: "transport without TLS config", setup: func(p *unifi.Provider) { p.Transport = &http.Transport{} }},
+		// The transports are cloned with the TLS options replacing their own TLS config
+		{name: "system roots on custom transport", setup: func(p *unifi.Provider) { p.Transport = fake.Client().Transport; p.TLSVerify = true }, wantErr: true},
+		{name: "CA file on custom transport", setup: func(p *unifi.Provider) { p.Transport = &http.Transport{}; p.TLSCAFile = caFile }},
+		{name: "CA file on custom client transport", setup: func(p *unifi.Provider) {
+			p.HTTPClient = &http.Client{Transport: &http.Transport{}}
+			p.TLSCAFile = caFile
+		}},
+		{name: "TLS options with opaque transport", setup: func(p *unifi.Provider) {
+			p.Transport = &countingTransport{base: fake.Client().Transport}
+			p.TLSCAFile = caFile
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &unifi.Provider{
+				APIKey:  fake.APIKey,
+				SiteId:  fake.SiteID,
+				BaseUrl: fake.BaseURL(),
+			}
+			tt.setup(provider)
+
+			_, err := provider.GetRecords(context.Background(), "example.com")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestTLSOptionsConflict tests that TLS options and a custom transport are rejected up front
+func TestTLSOptionsConflict(t *testing.T) {
+	provider := &unifi.Provider{
+		APIKey:    "key",
+		SiteId:    "site",
+		BaseUrl:   "192.168.1.1",
+		Transport: &countingTransport{base: http.DefaultTransport},
+		TLSVerify: true,
+	}
+	if err := provider.Validate(); err == nil || !strings.Contains(err.Error(), "custom transport") {
+		t.Errorf("Expected a conflict error, got %v", err)
+	}
+}
+
+// TestTimeouts tests the overall, per-request and list timeouts
+func TestTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(p *unifi.Provider)
+		deadline time.Duration
+		wantErr  bool
+	}{
+		{name: "no timeouts", setup: func(p *unifi.Provider) {}},
+		{name: "overall timeout", setup: func(p *unifi.Provider) { p.Timeout = 20 * time.Millisecond }, wantErr: true},
+		{name: "request timeout", setup: func(p *unifi.Provider) { p.RequestTimeout = 20 * time.Millisecond }, wantErr: true},
+		{name: "list timeout", setup: func(p *unifi.Provider) { p.ListTimeout = 20 * time.Millisecond }, wantErr: true},
+		{name: "context deadline overrides timeout", setup: func(p *unifi.Provider) { p.Timeout = 20 * time.Millisecond }, deadline: 5 * time.Second},
+		{name: "shorter context deadline", setup: func(p *unifi.Provider) {}, deadline: 20 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, provider, ctx := setupFake(t)
+			fake.SetDelay(100 * time.Millisecond)
+			tt.setup(provider)
+
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+				defer cancel()
+			}
+
+			_, err := provider.GetRecords(ctx, "example.com")
+			if tt.wantErr && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Expected deadline exceeded, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clearEnv unsets the default configuration variables for the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+
+	for _, name := range []string{"API_KEY", "SITE_ID", "BASE_URL", "CONFIG_FILE"} {
+		for _, suffix := range []string{"", "_FILE"} {
+			key := unifi.DefaultEnvPrefix + name + suffix
+			if value, ok := os.LookupEnv(key); ok {
+				os.Unsetenv(key)
+				t.Cleanup(func() { os.Setenv(key, value) })
+			}
+		}
+	}
+}
+
+// TestLoadConfigPrecedence tests that fields win over the environment, which wins over files
+func TestLoadConfigPrecedence(t *testing.T) {
+	clearEnv(t)
+
+	secret := writeFile(t, "api_key", "secret-from-file\n")
+	config := writeFile(t, "unifi.yaml", `
+# controller settings
+api_key: "ignored"
+site_id: 'site-from-file'
+base_url: https://192.168.1.1/proxy/network/integration/v1 # UniFi OS
+`)
+
+	t.Setenv("UNIFI_LAB_API_KEY_FILE", secret)
+	t.Setenv("UNIFI_LAB_SITE_ID", "")
+	t.Setenv("UNIFI_LAB_BASE_URL", "https://10.0.0.1/proxy/network/integration/v1")
+
+	provider := &unifi.Provider{
+		EnvPrefix:  "UNIFI_LAB",
+		ConfigFile: config,
+	}
+
+	cfg, err := provider.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	want := unifi.Config{
+		APIKey:  unifi.ConfigValue{Value: "secret-from-file", Source: unifi.SourceEnvFile, Origin: secret},
+		SiteID:  unifi.ConfigValue{Value: "site-from-file", Source: unifi.SourceFile, Origin: config},
+		BaseURL: unifi.ConfigValue{Value: "https://10.0.0.1/proxy/network/integration/v1", Source: unifi.SourceEnv, Origin: "UNIFI_LAB_BASE_URL"},
+	}
+	if cfg != want {
+		t.Errorf("Expected %+v, got %+v", want, cfg)
+	}
+	if strings.Contains(cfg.String(), "secret-from-file") {
+		t.Errorf("Config.String revealed the API key: %s", cfg)
+	}
+
+	provider.SiteId = "site-from-field"
+	cfg, err = provider.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.SiteID.Value != "site-from-field" || cfg.SiteID.Source != unifi.SourceField {
+		t.Errorf("Expected site ID from field, got %+v", cfg.SiteID)
+	}
+}
+
+// TestLoadConfigFormats tests reading JSON and key-value line files
+func TestLoadConfigFormats(t *testing.T) {
+	clearEnv(t)
+
+	files := map[string]string{
+		"unifi.json": `{"api_key": "key", "site_id": "site", "base_url": "https://unifi"}`,
+		"unifi.yml":  "api_key: key\nsite_id: site\nbase_url: \"https://unifi\"\n",
+		"unifi.toml": "# UniFi\napi_key = \"key\"\nsite_id = 'site'\nbase_url = \"https://unifi\" # comment\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			provider := &unifi.Provider{ConfigFile: writeFile(t, name, content)}
+
+			cfg, err := provider.LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if cfg.APIKey.Value != "key" || cfg.SiteID.Value != "site" || cfg.BaseURL.Value != "https://unifi" {
+				t.Errorf("Unexpected config: %+v", cfg)
+			}
+		})
+	}
+}
+
+// TestLoadConfigErrors tests that misconfiguration is reported instead of ignored
+func TestLoadConfigErrors(t *testing.T) {
+	clearEnv(t)
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		file    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "missing values",
+			env:     map[string]string{"UNIFI_API_KEY": "key"},
+			wantErr: "site ID is required",
+		},
+		{
+			name:    "value and file variable",
+			env:     map[string]string{"UNIFI_API_KEY": "key", "UNIFI_API_KEY_FILE": "/run/secrets/key"},
+			wantErr: "both UNIFI_API_KEY and UNIFI_API_KEY_FILE are set",
+		},
+		{
+			name:    "unreadable secret",
+			env:     map[string]string{"UNIFI_API_KEY_FILE": "/nonexistent/key"},
+			wantErr: "failed to read API key from UNIFI_API_KEY_FILE",
+		},
+		{
+			name:    "nested YAML",
+			file:    "unifi.yaml",
+			content: "unifi:\n  api_key: key\n",
+			wantErr: "nested values are not supported",
+		},
+		{
+			name:    "YAML block scalar",
+			file:    "unifi.yaml",
+			content: "api_key: |\n  key\n",
+			wantErr: "only plain or quoted values are supported",
+		},
+		{
+			name:    "YAML flow mapping",
+			file:    "unifi.yml",
+			content: "unifi: {api_key: key}\n",
+			wantErr: "only plain or quoted values are supported",
+		},
+		{
+			name:    "bare TOML string",
+			file:    "unifi.toml",
+			content: "api_key = key\n",
+			wantErr: "value of api_key must be a quoted string",
+		},
+		{
+			name:    "TOML table",
+			file:    "unifi.toml",
+			content: "[unifi]\napi_key = \"key\"\n",
+			wantErr: "expected key= value",
+		},
+		{
+			name:    "text after quoted value",
+			file:    "unifi.toml",
+			content: "api_key = \"key\" extra\n",
+			wantErr: "unexpected \"extra\" after value",
+		},
+		{
+			name:    "line without separator",
+			file:    "unifi.yaml",
+			content: "api_key: key\nsite_id\n",
+			wantErr: "line 2: expected key: value",
+		},
+		{
+			name:    "invalid key",
+			file:    "unifi.yaml",
+			content: "# settings\napi key: key\n",
+			wantErr: "line 2: invalid key \"api key\"",
+		},
+		{
+			name:    "unreadable config file",
+			env:     map[string]string{"UNIFI_API_KEY": "key", "UNIFI_SITE_ID": "site"},
+			file:    "missing.yaml",
+			wantErr: "failed to load config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			provider := &unifi.Provider{}
+			switch {
+			case tt.content != "":
+				provider.ConfigFile = writeFile(t, tt.file, tt.content)
+			case tt.file != "":
+				provider.ConfigFile = filepath.Join(t.TempDir(), tt.file)
+			}
+
+			_, err := provider.LoadConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestLoadConfigFileNotNeeded tests that the config file is not read when
+// every value is set elsewhere
+func TestLoadConfigFileNotNeeded(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("UNIFI_BASE_URL", "https://192.168.1.1")
+
+	provider := &unifi.Provider{
+		APIKey:     "key",
+		SiteId:     "site",
+		ConfigFile: filepath.Join(t.TempDir(), "missing.yaml"),
+	}
+	cfg, err := provider.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.BaseURL.Source != unifi.SourceEnv {
+		t.Errorf("Expected the base URL from the environment, got %s", cfg.BaseURL.Source)
+	}
+}
+
+// TestBaseURLDiscovery tests that a bare controller address finds the integration API
+func TestBaseURLDiscovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		baseURL func(fake *unifitest.Server) string
+		apiKey  string
+		wantErr string
+	}{
+		{
+			name:    "UniFi OS",
+			baseURL: func(fake *unifitest.Server) string { return fake.URL + "/" },
+		},
+		{
+			name:    "standalone controller",
+			path:    "/integration/v1",
+			baseURL: func(fake *unifitest.Server) string { return fake.URL },
+		},
+		{
+			name:    "bare host defaults to https",
+			baseURL: func(fake *unifitest.Server) string { return strings.TrimPrefix(fake.URL, "https://") },
+		},
+		{
+			name:    "full URL with trailing slash",
+			baseURL: func(fake *unifitest.Server) string { return fake.BaseURL() + "//" },
+		},
+		{
+			name:    "partial UniFi OS path",
+			baseURL: func(fake *unifitest.Server) string { return fake.URL + "/proxy/network/" },
+		},
+		{
+			name:    "custom path as given",
+			path:    "/unifi-api",
+			baseURL: func(fake *unifitest.Server) string { return fake.URL + "/unifi-api" },
+		},
+		{
+			name:    "wrong partial path",
+			baseURL: func(fake *unifitest.Server) string { return fake.URL + "/network" },
+			wantErr: "set the full base URL, ending in /integration/v1",
+		},
+		{
+			name:    "no integration API",
+			path:    "/api",
+			baseURL: func(fake *unifitest.Server) string { return fake.URL },
+			wantErr: "no UniFi Network integration API found",
+		},
+		{
+			name:    "invalid API key",
+			baseURL: func(fake *unifitest.Server) string { return fake.URL },
+			apiKey:  "wrong-key",
+			wantErr: "status 401",
+		},
+		{
+			name:    "unsupported scheme",
+			baseURL: func(fake *unifitest.Server) string { return "ftp://192.168.1.1" },
+			wantErr: "scheme must be https or http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := unifitest.NewTLSServer()
+			defer fake.Close()
+			if tt.path != "" {
+				fake.Path = tt.path
+			}
+			fake.AddPolicy(api.DNSPolicy{
+				Type:        api.RecordTypeA,
+				Domain:      "www.example.com",
+				IPv4Address: "192.0.2.1",
+				Enabled:     true,
+			})
+
+			provider := &unifi.Provider{
+				APIKey:  fake.APIKey,
+				SiteId:  fake.SiteID,
+				BaseUrl: tt.baseURL(fake),
+			}
+			if tt.apiKey != "" {
+				provider.APIKey = tt.apiKey
+			}
+
+			records, err := provider.GetRecords(context.Background(), "example.com")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetRecords failed: %v", err)
+			}
+			if len(records) != 1 {
+				t.Errorf("Expected 1 record, got %d", len(records))
+			}
+		})
+	}
+}
+
+// TestCheck tests the report of Check for working and broken configurations
+func TestCheck(t *testing.T) {
+	fake := unifitest.NewServer()
+	defer fake.Close()
+
+	closed := unifitest.NewServer()
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		provider *unifi.Provider
+		want     map[string]unifi.CheckStatus
+	}{
+		{
+			name:     "healthy",
+			provider: &unifi.Provider{APIKey: fake.APIKey, SiteId: fake.SiteID, BaseUrl: fake.BaseURL()},
+			want: map[string]unifi.CheckStatus{
+				unifi.CheckConfig:     unifi.CheckOK,
+				unifi.CheckController: unifi.CheckOK,
+				unifi.CheckAPIKey:     unifi.CheckOK,
+				unifi.CheckSite:       unifi.CheckOK,
+				unifi.CheckPolicies:   unifi.CheckOK,
+			},
+		},
+		{
+			name:     "missing site ID",
+			provider: &unifi.Provider{APIKey: fake.APIKey, BaseUrl: fake.BaseURL(), EnvPrefix: "UNIFI_CHECK_TEST"},
+			want: map[string]unifi.CheckStatus{
+				unifi.CheckConfig:     unifi.CheckFailed,
+				unifi.CheckController: unifi.CheckSkipped,
+				unifi.CheckAPIKey:     unifi.CheckSkipped,
+				unifi.CheckSite:       unifi.CheckSkipped,
+				unifi.CheckPolicies:   unifi.CheckSkipped,
+			},
+		},
+		{
+			name:     "unreachable controller",
+			provider: &unifi.Provider{APIKey: fake.APIKey, SiteId: fake.SiteID, BaseUrl: closed.BaseURL()},
+			want: map[string]unifi.CheckStatus{
+				unifi.CheckConfig:     unifi.CheckOK,
+				unifi.CheckController: unifi.CheckFailed,
+				unifi.CheckAPIKey:     unifi.CheckSkipped,
+				unifi.CheckSite:       unifi.CheckSkipped,
+				unifi.CheckPolicies:   unifi.CheckSkipped,
+			},
+		},
+		{
+			name:     "invalid API key",
+			provider: &unifi.Provider{APIKey: "wrong-key", SiteId: fake.SiteID, BaseUrl: fake.URL},
+			want: map[string]unifi.CheckStatus{
+				unifi.CheckConfig:     unifi.CheckOK,
+				unifi.CheckController: unifi.CheckOK,
+				unifi.CheckAPIKey:     unifi.CheckFailed,
+				unifi.CheckSite:       unifi.CheckSkipped,
+				unifi.CheckPolicies:   unifi.CheckSkipped,
+			},
+		},
+		{
+			name:     "unknown site",
+			provider: &unifi.Provider{APIKey: fake.APIKey, SiteId: "no-such-site", BaseUrl: fake.BaseURL()},
+			want: map[string]unifi.CheckStatus{
+				unifi.CheckConfig:     unifi.CheckOK,
+				unifi.CheckController: unifi.CheckOK,
+				unifi.CheckAPIKey:     unifi.CheckOK,
+				unifi.CheckSite:       unifi.CheckFailed,
+				unifi.CheckPolicies:   unifi.CheckSkipped,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := tt.provider.Check(context.Background())
+
+			if len(report.Checks) != len(tt.want) {
+				t.Fatalf("Expected %d checks, got %+v", len(tt.want), report.Checks)
+			}
+			failed := false
+			for _, check := range report.Checks {
+				if check.Status != tt.want[check.Name] {
+					t.Errorf("Check %s: expected %s, got %s (%s)", check.Name, tt.want[check.Name], check.Status, check.Error)
+				}
+				if check.Status == unifi.CheckFailed && check.Error == "" {
+					t.Errorf("Check %s failed without an error", check.Name)
+				}
+				failed = failed || check.Status == unifi.CheckFailed
+			}
+			if report.OK() == failed {
+				t.Errorf("Expected OK() to be %v", !failed)
+			}
+		})
+	}
+}
+
+// TestCredentialsRotation tests that a rotated API key is picked up without recreating the provider
+func TestCredentialsRotation(t *testing.T) {
+	t.Run("secret file", func(t *testing.T) {
+		clearEnv(t)
+		fake, provider, ctx := setupFake(t)
+		provider.APIKey = ""
+
+		secret := writeFile(t, "api_key", fake.APIKey)
+		t.Setenv("UNIFI_API_KEY_FILE", secret)
+
+		if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+			t.Fatalf("GetRecords failed: %v", err)
+		}
+
+		fake.SetAPIKey("rotated-key")
+		if err := os.WriteFile(secret, []byte("rotated-key\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+			t.Fatalf("GetRecords after rotation failed: %v", err)
+		}
+	})
+
+	t.Run("callback", func(t *testing.T) {
+		fake, provider, ctx := setupFake(t)
+		provider.APIKey = ""
+
+		// The callback returns the old key once more, as a secret store
+		// that has not caught up yet would
+		var mu sync.Mutex
+		keys := []string{fake.APIKey}
+		calls := 0
+		provider.Credentials = unifi.CredentialsFunc(func(ctx context.Context) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			key := keys[0]
+			if len(keys) > 1 {
+				keys = keys[1:]
+			}
+			return key, nil
+		})
+		if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+			t.Fatalf("GetRecords failed: %v", err)
+		}
+
+		fake.SetAPIKey("rotated-key")
+		mu.Lock()
+		keys, calls = []string{keys[0], "rotated-key"}, 0
+		mu.Unlock()
+
+		requests := fake.Requests()
+		if _, err := provider.GetRecords(ctx, "example.com"); err != nil {
+			t.Fatalf("GetRecords after rotation failed: %v", err)
+		}
+		if got := fake.Requests() - requests; got != 2 {
+			t.Errorf("Expected a rejected request and a retry, got %d requests", got)
+		}
+		if calls != 2 {
+			t.Errorf("Expected credentials to be consulted twice, got %d", calls)
+		}
+	})
+
+	t.Run("static key", func(t *testing.T) {
+		fake, provider, ctx := setupFake(t)
+		fake.SetAPIKey("rotated-key")
+
+		_, err := provider.GetRecords(ctx, "example.com")
+		if err == nil || !strings.Contains(err.Error(), "status 401") {
+			t.Fatalf("Expected 401 error, got %v", err)
+		}
+		if got := fake.Requests(); got != 1 {
+			t.Errorf("Expected no retry with an unchanged key, got %d requests", got)
+		}
+	})
+}
+
+// TestVerify tests that written records are looked up on the gateway's resolver
+func TestVerify(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	provider.VerifyResolver = fake.StartDNS()
+	provider.VerifyTimeout = 2 * time.Second
+
+	records := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("2001:db8::1")},
+		libdns.CNAME{Name: "alias", Target: "www.example.com."},
+		// Too long for a UDP response, so verification falls back to TCP
+		libdns.TXT{Name: "long", Text: strings.Repeat("a", 600)},
+		libdns.MX{Name: "@", Preference: 10, Target: "mail.example.com"},
+		libdns.SRV{Service: "sip", Transport: "tcp", Name: "@", Priority: 1, Weight: 2, Port: 5060, Target: "sip.example.com"},
+	}
+
+	if _, err := provider.AppendRecords(ctx, "example.com", records); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	_, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+}
+
+// TestVerifyMismatch tests that records the resolver does not serve are reported
+func TestVerifyMismatch(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	fake.SetDNSDelay(time.Hour)
+	provider.VerifyResolver = fake.StartDNS()
+	provider.VerifyTimeout = 100 * time.Millisecond
+
+	records := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.TXT{Name: "www", Text: "hello"},
+	}
+	written, err := provider.AppendRecords(ctx, "example.com", records)
+
+	var verifyErr *unifi.VerifyError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("Expected VerifyError, got %v", err)
+	}
+	if len(verifyErr.Mismatches) != 2 {
+		t.Errorf("Expected 2 mismatches, got %+v", verifyErr.Mismatches)
+	}
+	if !strings.Contains(err.Error(), "www A \"192.0.2.1\": not served") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+	if len(written) != 2 || len(fake.Policies()) != 2 {
+		t.Errorf("Expected the written records to be returned and kept, got %v", written)
+	}
+}
+
+// TestTXTValues tests that long, empty, multi-string and quoted TXT values are stored, served and read back
+func TestTXTValues(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	provider.VerifyResolver = fake.StartDNS()
+	provider.VerifyTimeout = 2 * time.Second
+
+	key := strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A", 12)
+	records := []libdns.Record{
+		libdns.TXT{Name: "selector._domainkey", Text: `"v=DKIM1; k=rsa; " "p=` + key[:200] + `" "` + key[200:] + `"`},
+		libdns.TXT{Name: "empty", Text: ""},
+		libdns.TXT{Name: "quoted", Text: `"heritage=external-dns"`},
+		libdns.TXT{Name: "embedded", Text: `say "hi" and "bye"`},
+		libdns.TXT{Name: "adjacent", Text: `"a""b"`},
+	}
+	if _, err := provider.AppendRecords(ctx, "example.com", records); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	got, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	want := map[string]string{
+		"selector._domainkey": "v=DKIM1; k=rsa; p=" + key,
+		"empty":               "",
+		"quoted":              `"heritage=external-dns"`,
+		"embedded":            `say "hi" and "bye"`,
+		"adjacent":            `"a""b"`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d records, got %d", len(want), len(got))
+	}
+	for _, record := range got {
+		txt := record.(libdns.TXT)
+		if text, ok := want[txt.Name]; !ok || txt.Text != text {
+			t.Errorf("Unexpected record %s: %q", txt.Name, txt.Text)
+		}
+	}
+
+	// Records given in either form match the stored value
+	if _, err := provider.DeleteRecords(ctx, "example.com", records); err != nil {
+		t.Fatalf("DeleteRecords failed: %v", err)
+	}
+	if n := len(fake.Policies()); n != 0 {
+		t.Errorf("Expected all records to be deleted, %d left", n)
+	}
+}
+
+// TestTXTStoredAsStrings tests that a policy stored as quoted strings by
+// another client can be deleted using the record GetRecords returns
+func TestTXTStoredAsStrings(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	fake.AddPolicy(api.DNSPolicy{
+		Type:    api.RecordTypeTXT,
+		Domain:  "multi.example.com",
+		Text:    `"a" "b"`,
+		Enabled: true,
+	})
+
+	records, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if len(records) != 1 || records[0].(libdns.TXT).Text != "ab" {
+		t.Fatalf("Expected the joined text, got %+v", records)
+	}
+
+	deleted, err := provider.DeleteRecords(ctx, "example.com", records)
+	if err != nil {
+		t.Fatalf("DeleteRecords failed: %v", err)
+	}
+	if len(deleted) != 1 || len(fake.Policies()) != 0 {
+		t.Errorf("Expected the record to be deleted, deleted %d, %d left", len(deleted), len(fake.Policies()))
+	}
+}
+
+// TestMXPreferenceZero tests that a null MX with preference 0 is stored and read back as such
+func TestMXPreferenceZero(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+
+	records := []libdns.Record{
+		libdns.MX{Name: "@", Preference: 0, Target: "."},
+		libdns.MX{Name: "mail", Preference: 10, Target: "mx.example.com"},
+	}
+	if _, err := provider.AppendRecords(ctx, "example.com", records); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	for _, policy := range fake.Policies() {
+		if policy.Priority == nil {
+			t.Errorf("Expected priority to be sent for %s", policy.Domain)
+		}
+	}
+
+	got, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	want := map[string]uint16{"@": 0, "mail": 10}
+	for _, record := range got {
+		mx := record.(libdns.MX)
+		if preference, ok := want[mx.Name]; !ok || mx.Preference != preference {
+			t.Errorf("Unexpected MX record %s with preference %d", mx.Name, mx.Preference)
+		}
+	}
+
+	// Deleting matches on the preference, including 0
+	fake.AddPolicy(api.DNSPolicy{
+		Type:             api.RecordTypeMX,
+		Domain:           "example.com",
+		MailServerDomain: ".",
+		Priority:         api.Ptr(uint16(5)),
+		Enabled:          true,
+	})
+	if _, err := provider.DeleteRecords(ctx, "example.com", records[:1]); err != nil {
+		t.Fatalf("DeleteRecords failed: %v", err)
+	}
+	policies := fake.Policies()
+	if len(policies) != 2 || api.Deref(policies[1].Priority) != 5 {
+		t.Errorf("Expected only the preference 0 record to be deleted, got %+v", policies)
+	}
+}
+
+// TestZeroValuesStored tests that explicit zero TTL, weight and priority reach the controller
+func TestZeroValuesStored(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+
+	_, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "nocache", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Nanosecond},
+		libdns.Address{Name: "default", IP: netip.MustParseAddr("192.0.2.2")},
+		libdns.SRV{Service: "sip", Transport: "udp", Name: "@", Port: 5060, Target: "sip.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	for _, policy := range fake.Policies() {
+		switch policy.Domain {
+		case "nocache.example.com":
+			if policy.TTLSeconds == nil || *policy.TTLSeconds != 0 {
+				t.Errorf("Expected TTL of 0 seconds to be sent, got %v", policy.TTLSeconds)
+			}
+		case "default.example.com":
+			if policy.TTLSeconds != nil {
+				t.Errorf("Expected TTL to be left to the controller, got %d", *policy.TTLSeconds)
+			}
+		default:
+			if policy.Weight == nil || policy.Priority == nil || api.Deref(policy.Port) != 5060 {
+				t.Errorf("Expected SRV weight and priority 0 to be sent, got %+v", policy)
+			}
+		}
+	}
+}
+
+// TestSetRecordsKeepsUnsetFields tests that updating a record keeps the policy's TTL and unknown fields
+func TestSetRecordsKeepsUnsetFields(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+
+	fake.AddPolicy(api.DNSPolicy{
+		Type:        api.RecordTypeA,
+		Domain:      "www.example.com",
+		IPv4Address: "192.0.2.1",
+		TTLSeconds:  api.Ptr(int32(600)),
+		Enabled:     true,
+		Extra:       map[string]json.RawMessage{"metadata": json.RawMessage(`{"origin":"USER_DEFINED"}`)},
+	})
+
+	if _, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")},
+	}); err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+
+	policies := fake.Policies()
+	if len(policies) != 1 {
+		t.Fatalf("Expected 1 policy, got %d", len(policies))
+	}
+	policy := policies[0]
+	if policy.IPv4Address != "192.0.2.2" {
+		t.Errorf("Expected address 192.0.2.2, got %s", policy.IPv4Address)
+	}
+	if api.Deref(policy.TTLSeconds) != 600 {
+		t.Errorf("Expected TTL to stay 600, got %v", policy.TTLSeconds)
+	}
+	if got := string(policy.Extra["metadata"]); got != `{"origin":"USER_DEFINED"}` {
+		t.Errorf("Expected metadata to be kept, got %s", got)
+	}
+}
+
+// TestListPoliciesExtra tests that fields unknown to DNSPolicy are returned to callers
+func TestListPoliciesExtra(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	fake.AddPolicy(unifi.DNSPolicy{
+		Type:        "A_RECORD",
+		Domain:      "www.example.com",
+		IPv4Address: "192.0.2.1",
+		Enabled:     true,
+		Extra: map[string]json.RawMessage{
+			"metadata":  json.RawMessage(`{"origin":"USER_DEFINED"}`),
+			"updatedAt": json.RawMessage(`"2026-01-01T00:00:00Z"`),
+		},
+	})
+
+	policies, err := provider.ListPolicies(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("ListPolicies failed: %v", err)
+	}
+	if len(policies) != 1 {
+		t.Fatalf("Expected 1 policy, got %d", len(policies))
+	}
+
+	var metadata struct{ Origin string }
+	if err := json.Unmarshal(policies[0].Extra["metadata"], &metadata); err != nil {
+		t.Fatalf("Failed to decode metadata: %v", err)
+	}
+	if metadata.Origin != "USER_DEFINED" {
+		t.Errorf("Expected origin USER_DEFINED, got %q", metadata.Origin)
+	}
+	if got := string(policies[0].Extra["updatedAt"]); got != `"2026-01-01T00:00:00Z"` {
+		t.Errorf("Unexpected updatedAt %s", got)
+	}
+}
+
+// TestGetRecordsByName tests that records of one name and type are fetched without listing the zone
+func TestGetRecordsByName(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+
+	// More policies than fit on one page
+	for i := 0; i < 30; i++ {
+		fake.AddPolicy(api.DNSPolicy{
+			Type:        api.RecordTypeA,
+			Domain:      fmt.Sprintf("host%d.example.com", i),
+			IPv4Address: fmt.Sprintf("192.0.2.%d", i),
+			Enabled:     true,
+		})
+	}
+	fake.AddPolicy(api.DNSPolicy{Type: api.RecordTypeA, Domain: "www.example.com", IPv4Address: "192.0.2.100", Enabled: true})
+	fake.AddPolicy(api.DNSPolicy{Type: api.RecordTypeTXT, Domain: "www.example.com", Text: "hello", Enabled: true})
+	fake.AddPolicy(api.DNSPolicy{Type: api.RecordTypeA, Domain: "www.example.org", IPv4Address: "192.0.2.200", Enabled: true})
+
+	tests := []struct {
+		recordType string
+		want       int
+	}{
+		{recordType: "", want: 2},
+		{recordType: "A", want: 1},
+		{recordType: "txt", want: 1},
+		{recordType: "MX", want: 0},
+	}
+	for _, tt := range tests {
+		requests := fake.Requests()
+		records, err := provider.GetRecordsByName(ctx, "example.com", "www", tt.recordType)
+		if err != nil {
+			t.Fatalf("GetRecordsByName(%q) failed: %v", tt.recordType, err)
+		}
+		if len(records) != tt.want {
+			t.Errorf("GetRecordsByName(%q): expected %d records, got %v", tt.recordType, tt.want, records)
+		}
+		for _, record := range records {
+			if record.RR().Name != "www" {
+				t.Errorf("GetRecordsByName(%q): unexpected record %v", tt.recordType, record)
+			}
+		}
+		if got := fake.Requests() - requests; got != 1 {
+			t.Errorf("GetRecordsByName(%q): expected 1 request, got %d", tt.recordType, got)
+		}
+	}
+
+	if _, err := provider.GetRecordsByName(ctx, "example.com", "www", "NS"); err == nil {
+		t.Error("Expected an error for an unsupported type")
+	}
+}
+
+// TestSingleNameChanges tests that changing the records of one name only fetches that name's policies
+func TestSingleNameChanges(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+
+	for i := 0; i < 30; i++ {
+		fake.AddPolicy(api.DNSPolicy{
+			Type:        api.RecordTypeA,
+			Domain:      fmt.Sprintf("host%d.example.com", i),
+			IPv4Address: fmt.Sprintf("192.0.2.%d", i),
+			Enabled:     true,
+		})
+	}
+
+	records := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.100"), TTL: time.Hour},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("2001:db8::1"), TTL: time.Hour},
+	}
+	if _, err := provider.SetRecords(ctx, "example.com", records); err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+	// 1 lookup and 2 creates
+	if got := fake.Requests(); got != 3 {
+		t.Errorf("Expected 3 requests, got %d", got)
+	}
+
+	if _, err := provider.DeleteRecords(ctx, "example.com", records); err != nil {
+		t.Fatalf("DeleteRecords failed: %v", err)
+	}
+	// 1 lookup and 2 deletes
+	if got := fake.Requests(); got != 6 {
+		t.Errorf("Expected 6 requests, got %d", got)
+	}
+	if got := len(fake.Policies()); got != 30 {
+		t.Errorf("Expected 30 policies to remain, got %d", got)
+	}
+}
+
+// TestGetRecordsByNameSRV tests that SRV records are found by their full name
+func TestGetRecordsByNameSRV(t *testing.T) {
+	_, provider, ctx := setupFake(t)
+
+	records := []libdns.Record{
+		libdns.SRV{Service: "sip", Transport: "tcp", Name: "@", Priority: 1, Weight: 1, Port: 5060, Target: "sip.example.com"},
+		libdns.SRV{Service: "sip", Transport: "udp", Name: "@", Priority: 1, Weight: 1, Port: 5060, Target: "sip.example.com"},
+		libdns.SRV{Service: "xmpp", Transport: "tcp", Name: "chat", Priority: 1, Weight: 1, Port: 5222, Target: "xmpp.example.com"},
+		libdns.TXT{Name: "_sip._tcp", Text: "not an SRV record"},
+	}
+	if _, err := provider.AppendRecords(ctx, "example.com", records); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		recordType string
+		want       []libdns.Record
+	}{
+		{name: "_sip._tcp", recordType: "SRV", want: records[:1]},
+		{name: "_sip._tcp", recordType: "", want: []libdns.Record{records[3], records[0]}},
+		{name: "_SIP._UDP", recordType: "SRV", want: records[1:2]},
+		{name: "_xmpp._tcp.chat", recordType: "SRV", want: records[2:3]},
+		{name: "_xmpp._tcp.chat.example.com.", recordType: "SRV", want: records[2:3]},
+		{name: "_xmpp._tcp", recordType: "SRV", want: nil},
+	}
+	for _, tt := range tests {
+		got, err := provider.GetRecordsByName(ctx, "example.com", tt.name, tt.recordType)
+		if err != nil {
+			t.Fatalf("GetRecordsByName(%q, %q) failed: %v", tt.name, tt.recordType, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("GetRecordsByName(%q, %q): expected %v, got %v", tt.name, tt.recordType, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i].RR() != tt.want[i].RR() {
+				t.Errorf("GetRecordsByName(%q, %q): expected %v, got %v", tt.name, tt.recordType, tt.want[i].RR(), got[i].RR())
+			}
+		}
+	}
+}
+
+// TestGetRecordsByNameEscapes tests that URL and filter delimiters in names reach the
+// filter intact and that quotes are rejected
+func TestGetRecordsByNameEscapes(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+
+	fake.AddPolicy(api.DNSPolicy{Type: api.RecordTypeTXT, Domain: "o&co.example.com", Text: "hello", Enabled: true})
+	fake.AddPolicy(api.DNSPolicy{Type: api.RecordTypeTXT, Domain: "o.example.com", Text: "other", Enabled: true})
+
+	for _, name := range []string{"o&co", "o#x", "o+x", "o)x"} {
+		records, err := provider.GetRecordsByName(ctx, "example.com", name, "TXT")
+		if err != nil {
+			t.Fatalf("GetRecordsByName(%q) failed: %v", name, err)
+		}
+		want := 0
+		if name == "o&co" {
+			want = 1
+		}
+		if len(records) != want {
+			t.Errorf("GetRecordsByName(%q): expected %d records, got %v", name, want, records)
+		}
+	}
+
+	// Quotes and backslashes have no documented escape in the filter syntax
+	for _, name := range []string{"o'brien", `o\'x`} {
+		if _, err := provider.GetRecordsByName(ctx, "example.com", name, "TXT"); err == nil {
+			t.Errorf("GetRecordsByName(%q): expected an error", name)
+		}
+	}
+}
+
+// TestWildcardRecords tests that wildcard records are written, listed, resolved and deleted
+func TestWildcardRecords(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+	provider.VerifyResolver = fake.StartDNS()
+	provider.VerifyTimeout = 2 * time.Second
+
+	// A policy of another zone that a suffix match would take for example.com's
+	fake.AddPolicy(api.DNSPolicy{Type: api.RecordTypeA, Domain: "*.myexample.com", IPv4Address: "192.0.2.99", Enabled: true})
+
+	records := []libdns.Record{
+		libdns.Address{Name: "*", IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.Address{Name: "*.sub", IP: netip.MustParseAddr("192.0.2.2")},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.3")},
+	}
+	if _, err := provider.AppendRecords(ctx, "example.com", records); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	got, err := provider.GetRecords(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	var names []string
+	for _, record := range got {
+		names = append(names, record.RR().Name)
+	}
+	sort.Strings(names)
+	if want := []string{"*", "*.sub", "www"}; !equalStrings(names, want) {
+		t.Errorf("Expected names %v, got %v", want, names)
+	}
+
+	wildcards, err := provider.GetRecordsByName(ctx, "example.com", "*.sub", "A")
+	if err != nil {
+		t.Fatalf("GetRecordsByName failed: %v", err)
+	}
+	if len(wildcards) != 1 || wildcards[0].(libdns.Address).IP.String() != "192.0.2.2" {
+		t.Errorf("Unexpected wildcard records: %v", wildcards)
+	}
+
+	// Names without records of their own are answered from the closest wildcard
+	for name, want := range map[string]string{
+		"foo.example.com.":     "192.0.2.1",
+		"foo.sub.example.com.": "192.0.2.2",
+		"www.example.com.":     "192.0.2.3",
+	} {
+		resp, err := dnswire.Exchange(ctx, provider.VerifyResolver, dnswire.NewQuery(name, dnswire.TypeA))
+		if err != nil {
+			t.Fatalf("Query for %s failed: %v", name, err)
+		}
+		if len(resp.Answers) != 1 || resp.Answers[0].Addr.String() != want {
+			t.Errorf("Expected %s for %s, got %v", want, name, resp.Answers)
+		}
+	}
+
+	// Replacing the wildcard leaves the names it covers alone
+	if _, err := provider.SetRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "*", IP: netip.MustParseAddr("192.0.2.10")},
+	}); err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+	if _, err := provider.DeleteRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "*", IP: netip.MustParseAddr("192.0.2.10")},
+	}); err != nil {
+		t.Fatalf("DeleteRecords failed: %v", err)
+	}
+
+	domains := make(map[string]bool)
+	for _, policy := range fake.Policies() {
+		domains[policy.Domain] = true
+	}
+	for domain, want := range map[string]bool{
+		"*.example.com":     false,
+		"*.sub.example.com": true,
+		"www.example.com":   true,
+		"*.myexample.com":   true,
+	} {
+		if domains[domain] != want {
+			t.Errorf("Expected policy for %s to exist: %v", domain, want)
+		}
+	}
+
+	if _, err := provider.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "www.*", IP: netip.MustParseAddr("192.0.2.4")},
+	}); err == nil {
+		t.Error("Expected an error for a wildcard that is not the leftmost label")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestZoneNames tests that zones with trailing dots and names in other cases are handled,
+// and that absolute names outside the zone are rejected
+func TestZoneNames(t *testing.T) {
+	fake, provider, ctx := setupFake(t)
+
+	// Not part of example.com, although it ends with it
+	fake.AddPolicy(api.DNSPolicy{Type: api.RecordTypeA, Domain: "myexample.com", IPv4Address: "192.0.2.99", Enabled: true})
+	// Stored in another case than it is written below; updating it
+	// replaces the policy rather than adding another one
+	fake.AddPolicy(api.DNSPolicy{Type: api.RecordTypeA, Domain: "Mail.Example.com", IPv4Address: "192.0.2.2", Enabled: true})
+
+	if _, err := provider.AppendRecords(ctx, "example.com.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.TXT{Name: "@", Text: "hello"},
+	}); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+
+	if _, err := provider.SetRecords(ctx, "example.com.", []libdns.Record{
+		libdns.Address{Name: "mail", IP: netip.MustParseAddr("192.0.2.3")},
+	}); err != nil {
+		t.Fatalf("SetRecords failed: %v", err)
+	}
+
+	domains := make(map[string]string)
+	for _, policy := range fake.Policies() {
+		domains[policy.Domain] = policy.IPv4Address + policy.Text
+	}
+	want := map[string]string{
+		"myexample.com":    "192.0.2.99",
+		"mail.example.com": "192.0.2.3",
+		"www.example.com":  "192.0.2.1",
+		"example.com":      "hello",
+	}
+	if len(domains) != len(want) {
+		t.Errorf("Expected policies %v, got %v", want, domains)
+	}
+	for domain, value := range want {
+		if domains[domain] != value {
+			t.Errorf("Expected %s for %s, got %q", value, domain, domains[domain])
+		}
+	}
+
+	for _, zone := range []string{"example.com", "example.com.", "EXAMPLE.com."} {
+		records, err := provider.GetRecords(ctx, zone)
+		if err != nil {
+			t.Fatalf("GetRecords(%q) failed: %v", zone, err)
+		}
+		names := make(map[string]bool)
+		for _, record := range records {
+			names[record.RR().Name] = true
+		}
+		if len(names) != 3 || !names["www"] || !names["@"] || !names["mail"] {
+			t.Errorf("GetRecords(%q): unexpected names %v", zone, names)
+		}
+	}
+
+	// Absolute names must be in the zone
+	outside := []libdns.Record{libdns.Address{Name: "www.other.com.", IP: netip.MustParseAddr("192.0.2.4")}}
+	if _, err := provider.AppendRecords(ctx, "example.com.", outside); err == nil {
+		t.Error("AppendRecords: expected an error for a name outside the zone")
+	}
+	if _, err := provider.GetRecordsByName(ctx, "example.com.", "www.other.com.", ""); err == nil {
+		t.Error("GetRecordsByName: expected an error for a name outside the zone")
+	}
+	if n := len(fake.Policies()); n != len(want) {
+		t.Errorf("Expected %d policies, got %d", len(want), n)
+	}
+}
+
 // ExampleProvider demonstrates basic usage of the unifi provider
 func ExampleProvider() {
 	provider := unifi.Provider{
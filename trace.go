@@ -0,0 +1,37 @@
+package unifi
+
+import (
+	"context"
+
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// Tracer starts spans around Provider operations and API requests.
+// It is a minimal subset of OpenTelemetry's trace.Tracer.
+type Tracer = unifi.Tracer
+
+// Span is a single traced operation.
+type Span = unifi.Span
+
+// Attribute is a key/value pair describing a span.
+type Attribute = unifi.Attribute
+
+// startSpan starts the span of a Provider operation on zone with n input records.
+func (p *Provider) startSpan(ctx context.Context, operation, zone string, n int) (context.Context, Span) {
+	return unifi.StartSpan(ctx, p.Tracer, "unifi."+operation,
+		Attribute{Key: "unifi.zone", Value: zone},
+		Attribute{Key: "unifi.record_count", Value: n},
+	)
+}
+
+// endSpan adds the site to span, records err, if any, and ends the span.
+func (p *Provider) endSpan(span Span, err error) {
+	p.mu.Lock()
+	siteID := p.siteID
+	p.mu.Unlock()
+
+	if siteID != "" {
+		span.SetAttributes(Attribute{Key: "unifi.site_id", Value: siteID})
+	}
+	unifi.EndSpan(span, err)
+}
@@ -0,0 +1,182 @@
+package unifi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/unifi/internal/dnswire"
+	"github.com/libdns/unifi/internal/unifi"
+)
+
+// DefaultVerifyTimeout bounds verification when VerifyTimeout is zero.
+const DefaultVerifyTimeout = 30 * time.Second
+
+// verifyInterval is the delay between verification rounds.
+const verifyInterval = 500 * time.Millisecond
+
+// Mismatch is a written record the resolver did not serve.
+type Mismatch struct {
+	Record libdns.Record
+
+	// Served lists the records of the same name and type the resolver
+	// returned instead, in presentation format.
+	Served []string
+
+	// Err is the error of the last query, if it failed.
+	Err error
+}
+
+// VerifyError is returned by AppendRecords and SetRecords, along with the
+// written records, when the resolver does not serve all of them within
+// VerifyTimeout.
+type VerifyError struct {
+	Resolver   string
+	Mismatches []Mismatch
+}
+
+func (e *VerifyError) Error() string {
+	problems := make([]string, 0, len(e.Mismatches))
+	for _, m := range e.Mismatches {
+		rr := m.Record.RR()
+		problem := fmt.Sprintf("%s %s %q", rr.Name, rr.Type, rr.Data)
+		switch {
+		case m.Err != nil:
+			problem += fmt.Sprintf(": %v", m.Err)
+		case len(m.Served) == 0:
+			problem += ": not served"
+		default:
+			problem += ": served " + strings.Join(m.Served, ", ")
+		}
+		problems = append(problems, problem)
+	}
+	return fmt.Sprintf("%d record(s) not served by %s: %s", len(e.Mismatches), e.Resolver, strings.Join(problems, "; "))
+}
+
+// verify queries VerifyResolver for the written records until it serves all
+// of them, returning a *VerifyError listing the records it still does not
+// serve when VerifyTimeout elapses.
+func (p *Provider) verify(ctx context.Context, zone string, records []libdns.Record) error {
+	if p.VerifyResolver == "" || len(records) == 0 {
+		return nil
+	}
+
+	timeout := p.VerifyTimeout
+	if timeout <= 0 {
+		timeout = DefaultVerifyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addr := dnswire.HostPort(p.VerifyResolver)
+	pending := records
+	for {
+		mismatches := verifyRound(ctx, addr, zone, pending)
+		if len(mismatches) == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(verifyInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &VerifyError{Resolver: addr, Mismatches: mismatches}
+		case <-timer.C:
+		}
+
+		pending = pending[:0:0]
+		for _, m := range mismatches {
+			pending = append(pending, m.Record)
+		}
+	}
+}
+
+// verifyRound queries the resolver once for each name and type among
+// records and returns the records it does not serve.
+func verifyRound(ctx context.Context, addr, zone string, records []libdns.Record) []Mismatch {
+	type question struct {
+		name  string
+		qtype uint16
+	}
+	answers := make(map[question][]dnswire.RR)
+	errs := make(map[question]error)
+
+	var mismatches []Mismatch
+	for _, record := range records {
+		rr := record.RR()
+		q := question{strings.ToLower(libdns.AbsoluteName(rr.Name, zone)), recordType(record)}
+
+		if _, ok := answers[q]; !ok && errs[q] == nil {
+			queryCtx, cancel := context.WithTimeout(ctx, verifyInterval)
+			resp, err := dnswire.Exchange(queryCtx, addr, dnswire.NewQuery(q.name, q.qtype))
+			cancel()
+			if err != nil {
+				errs[q] = err
+			} else {
+				answers[q] = append([]dnswire.RR{}, resp.Answers...)
+			}
+		}
+		if errs[q] != nil {
+			mismatches = append(mismatches, Mismatch{Record: record, Err: errs[q]})
+			continue
+		}
+
+		served := false
+		var others []string
+		for _, answer := range answers[q] {
+			if answer.Type != q.qtype {
+				continue
+			}
+			if servedAs(record, answer) {
+				served = true
+				break
+			}
+			others = append(others, answer.String())
+		}
+		if !served {
+			mismatches = append(mismatches, Mismatch{Record: record, Served: others})
+		}
+	}
+	return mismatches
+}
+
+// recordType returns the query type of a record.
+func recordType(record libdns.Record) uint16 {
+	switch r := record.(type) {
+	case libdns.Address:
+		if r.IP.Is4() {
+			return dnswire.TypeA
+		}
+		return dnswire.TypeAAAA
+	case libdns.CNAME:
+		return dnswire.TypeCNAME
+	case libdns.TXT:
+		return dnswire.TypeTXT
+	case libdns.MX:
+		return dnswire.TypeMX
+	case libdns.SRV:
+		return dnswire.TypeSRV
+	default:
+		return 0
+	}
+}
+
+// servedAs reports whether answer has the data of record. TTLs are not compared.
+func servedAs(record libdns.Record, answer dnswire.RR) bool {
+	switch r := record.(type) {
+	case libdns.Address:
+		return answer.Addr.Unmap() == r.IP.Unmap()
+	case libdns.CNAME:
+		return unifi.SameName(answer.Target, r.Target)
+	case libdns.TXT:
+		return strings.Join(answer.Text, "") == unifi.JoinTXTStrings(r.Text)
+	case libdns.MX:
+		return answer.Preference == r.Preference && unifi.SameName(answer.Target, r.Target)
+	case libdns.SRV:
+		return answer.Priority == r.Priority && answer.Weight == r.Weight && answer.Port == r.Port && unifi.SameName(answer.Target, r.Target)
+	default:
+		return false
+	}
+}
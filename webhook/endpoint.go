@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"strings"
+)
+
+// Endpoint is a DNS name with its targets as exchanged with external-dns.
+// It mirrors the JSON form of external-dns' endpoint.Endpoint.
+type Endpoint struct {
+	DNSName          string             `json:"dnsName,omitempty"`
+	Targets          []string           `json:"targets,omitempty"`
+	RecordType       string             `json:"recordType,omitempty"`
+	SetIdentifier    string             `json:"setIdentifier,omitempty"`
+	RecordTTL        int64              `json:"recordTTL,omitempty"`
+	Labels           map[string]string  `json:"labels,omitempty"`
+	ProviderSpecific []ProviderProperty `json:"providerSpecific,omitempty"`
+}
+
+// ProviderProperty is a provider specific key/value pair of an Endpoint.
+type ProviderProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Changes is the set of endpoint changes external-dns asks the provider to apply.
+type Changes struct {
+	Create    []*Endpoint `json:"create,omitempty"`
+	UpdateOld []*Endpoint `json:"updateOld,omitempty"`
+	UpdateNew []*Endpoint `json:"updateNew,omitempty"`
+	Delete    []*Endpoint `json:"delete,omitempty"`
+}
+
+// DomainFilter restricts the names managed by the webhook. Every included
+// domain is treated as a zone; names under an excluded domain are ignored.
+type DomainFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Zone returns the longest included domain containing name, or "" if name
+// is not managed according to the filter.
+func (f DomainFilter) Zone(name string) string {
+	name = normalizeName(name)
+	for _, exclude := range f.Exclude {
+		if isSubdomain(name, normalizeName(exclude)) {
+			return ""
+		}
+	}
+
+	var zone string
+	for _, include := range f.Include {
+		include = normalizeName(include)
+		if isSubdomain(name, include) && len(include) > len(zone) {
+			zone = include
+		}
+	}
+	return zone
+}
+
+// normalizeName lowercases name and strips its trailing dot.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// isSubdomain reports whether name equals domain or is below it.
+func isSubdomain(name, domain string) bool {
+	return domain != "" && (name == domain || strings.HasSuffix(name, "."+domain))
+}
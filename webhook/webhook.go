@@ -0,0 +1,316 @@
+// Package webhook implements an external-dns webhook provider that manages
+// DNS records through a libdns provider, typically a unifi.Provider.
+//
+// The server speaks the external-dns webhook protocol: negotiation on "/",
+// listing and applying changes on "/records" and endpoint adjustment on
+// "/adjustendpoints". Health probes are served separately by HealthHandler.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// MediaType is the content type of every webhook protocol request and response.
+const MediaType = "application/external.dns.webhook+json;version=1"
+
+// SupportedRecordTypes lists the endpoint record types the webhook manages.
+var SupportedRecordTypes = []string{"A", "AAAA", "CNAME", "TXT", "MX"}
+
+// Provider is the set of libdns interfaces the webhook needs.
+type Provider interface {
+	libdns.RecordGetter
+	libdns.RecordAppender
+	libdns.RecordDeleter
+}
+
+// Server translates external-dns webhook requests into Provider calls.
+type Server struct {
+	// Provider manages the records of every zone in DomainFilter.
+	Provider Provider
+
+	// DomainFilter is announced during negotiation and determines the zones.
+	DomainFilter DomainFilter
+}
+
+// New returns a Server for provider managing the zones in filter.
+func New(provider Provider, filter DomainFilter) *Server {
+	return &Server{
+		Provider:     provider,
+		DomainFilter: filter,
+	}
+}
+
+// Handler returns the webhook API handler.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleNegotiate)
+	mux.HandleFunc("/records", s.handleRecords)
+	mux.HandleFunc("/adjustendpoints", s.handleAdjustEndpoints)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	return mux
+}
+
+// HealthHandler returns a handler serving "/healthz" (liveness) and
+// "/readyz" (readiness, which requires the first zone to be readable).
+func (s *Server) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	return mux
+}
+
+// Records returns the managed records of all zones as endpoints.
+func (s *Server) Records(ctx context.Context) ([]*Endpoint, error) {
+	var endpoints []*Endpoint
+
+	for _, zone := range s.zones() {
+		records, err := s.Provider.GetRecords(ctx, zone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get records of zone %s: %w", zone, err)
+		}
+
+		index := make(map[string]*Endpoint)
+		for _, record := range records {
+			rr := record.RR()
+			if !supported(rr.Type) {
+				continue
+			}
+
+			name := normalizeName(libdns.AbsoluteName(rr.Name, zone))
+			if s.DomainFilter.Zone(name) != zone {
+				continue
+			}
+
+			key := name + " " + rr.Type
+			ep, ok := index[key]
+			if !ok {
+				ep = &Endpoint{
+					DNSName:    name,
+					RecordType: rr.Type,
+					RecordTTL:  int64(rr.TTL / time.Second),
+				}
+				index[key] = ep
+				endpoints = append(endpoints, ep)
+			}
+			ep.Targets = append(ep.Targets, rr.Data)
+		}
+	}
+
+	return endpoints, nil
+}
+
+// AdjustEndpoints drops endpoints that cannot be managed and normalizes the
+// rest the way Records reports them, so that external-dns plans no
+// perpetual updates.
+func (s *Server) AdjustEndpoints(endpoints []*Endpoint) []*Endpoint {
+	adjusted := make([]*Endpoint, 0, len(endpoints))
+
+	for _, ep := range endpoints {
+		if ep == nil || !supported(ep.RecordType) || s.DomainFilter.Zone(ep.DNSName) == "" {
+			continue
+		}
+
+		ep.DNSName = normalizeName(ep.DNSName)
+
+		// UniFi does not store a TTL for these policy types
+		if ep.RecordType == "TXT" || ep.RecordType == "MX" {
+			ep.RecordTTL = 0
+		}
+
+		adjusted = append(adjusted, ep)
+	}
+
+	return adjusted
+}
+
+// ApplyChanges deletes the old records and then creates the new ones.
+func (s *Server) ApplyChanges(ctx context.Context, changes Changes) error {
+	deletions, err := s.recordsByZone(changes.Delete, changes.UpdateOld)
+	if err != nil {
+		return err
+	}
+	creations, err := s.recordsByZone(changes.Create, changes.UpdateNew)
+	if err != nil {
+		return err
+	}
+
+	for _, zone := range sortedZones(deletions) {
+		if _, err := s.Provider.DeleteRecords(ctx, zone, deletions[zone]); err != nil {
+			return fmt.Errorf("failed to delete records in zone %s: %w", zone, err)
+		}
+	}
+	for _, zone := range sortedZones(creations) {
+		if _, err := s.Provider.AppendRecords(ctx, zone, creations[zone]); err != nil {
+			return fmt.Errorf("failed to create records in zone %s: %w", zone, err)
+		}
+	}
+
+	return nil
+}
+
+// recordsByZone converts endpoints to libdns records grouped by zone.
+// Endpoints outside the domain filter are skipped.
+func (s *Server) recordsByZone(lists ...[]*Endpoint) (map[string][]libdns.Record, error) {
+	var endpoints []*Endpoint
+	for _, list := range lists {
+		endpoints = append(endpoints, list...)
+	}
+
+	byZone := make(map[string][]libdns.Record)
+
+	for _, ep := range endpoints {
+		if ep == nil {
+			continue
+		}
+		zone := s.DomainFilter.Zone(ep.DNSName)
+		if zone == "" {
+			continue
+		}
+		if !supported(ep.RecordType) {
+			return nil, fmt.Errorf("unsupported record type %s for %s", ep.RecordType, ep.DNSName)
+		}
+
+		for _, target := range ep.Targets {
+			record, err := libdns.RR{
+				Name: libdns.RelativeName(normalizeName(ep.DNSName), zone),
+				Type: ep.RecordType,
+				TTL:  time.Duration(ep.RecordTTL) * time.Second,
+				Data: target,
+			}.Parse()
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s target %q for %s: %w", ep.RecordType, target, ep.DNSName, err)
+			}
+			byZone[zone] = append(byZone[zone], record)
+		}
+	}
+
+	return byZone, nil
+}
+
+// zones returns the normalized included domains.
+func (s *Server) zones() []string {
+	zones := make([]string, 0, len(s.DomainFilter.Include))
+	for _, include := range s.DomainFilter.Include {
+		zones = append(zones, normalizeName(include))
+	}
+	return zones
+}
+
+func (s *Server) handleNegotiate(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	writeJSON(w, s.DomainFilter)
+}
+
+func (s *Server) handleRecords(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		endpoints, err := s.Records(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if endpoints == nil {
+			endpoints = []*Endpoint{}
+		}
+		writeJSON(w, endpoints)
+
+	case http.MethodPost:
+		var changes Changes
+		if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+			http.Error(w, fmt.Sprintf("invalid changes: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := s.ApplyChanges(r.Context(), changes); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) handleAdjustEndpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var endpoints []*Endpoint
+	if err := json.NewDecoder(r.Body).Decode(&endpoints); err != nil {
+		http.Error(w, fmt.Sprintf("invalid endpoints: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, s.AdjustEndpoints(endpoints))
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	zones := s.zones()
+	if len(zones) == 0 {
+		http.Error(w, "no zones configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if _, err := s.Provider.GetRecords(ctx, zones[0]); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", MediaType)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	for _, method := range allowed {
+		w.Header().Add("Allow", method)
+	}
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
+
+func supported(recordType string) bool {
+	for _, t := range SupportedRecordTypes {
+		if t == recordType {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedZones(m map[string][]libdns.Record) []string {
+	zones := make([]string, 0, len(m))
+	for zone := range m {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	return zones
+}
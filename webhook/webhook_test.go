@@ -0,0 +1,217 @@
+package webhook_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/libdns/unifi"
+	"github.com/libdns/unifi/internal/unifitest"
+	"github.com/libdns/unifi/webhook"
+)
+
+// newProvider starts a fake controller, closed when the test ends, and
+// returns it with a provider using it
+func newProvider(t *testing.T) (*unifitest.Server, *unifi.Provider) {
+	t.Helper()
+
+	fake := unifitest.NewServer()
+	t.Cleanup(fake.Close)
+
+	return fake, &unifi.Provider{
+		APIKey:  fake.APIKey,
+		SiteId:  fake.SiteID,
+		BaseUrl: fake.BaseURL(),
+	}
+}
+
+// newTestServer returns a webhook server backed by a fake controller
+func newTestServer(t *testing.T) (*httptest.Server, *unifitest.Server) {
+	t.Helper()
+
+	fake, provider := newProvider(t)
+	server := webhook.New(provider, webhook.DomainFilter{
+		Include: []string{"example.com"},
+		Exclude: []string{"internal.example.com"},
+	})
+
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+
+	return ts, fake
+}
+
+func do(t *testing.T, method, url string, body any, out any) *http.Response {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", webhook.MediaType)
+	req.Header.Set("Content-Type", webhook.MediaType)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("failed to decode %s %s response: %v", method, url, err)
+		}
+	}
+	return resp
+}
+
+// TestNegotiate tests that the domain filter is announced
+func TestNegotiate(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	var filter webhook.DomainFilter
+	resp := do(t, http.MethodGet, ts.URL+"/", nil, &filter)
+
+	if got := resp.Header.Get("Content-Type"); got != webhook.MediaType {
+		t.Errorf("Expected content type %q, got %q", webhook.MediaType, got)
+	}
+	if !reflect.DeepEqual(filter.Include, []string{"example.com"}) {
+		t.Errorf("Unexpected include filter: %v", filter.Include)
+	}
+}
+
+// TestApplyChanges tests creating, updating and deleting endpoints
+func TestApplyChanges(t *testing.T) {
+	ts, fake := newTestServer(t)
+
+	changes := webhook.Changes{
+		Create: []*webhook.Endpoint{
+			{DNSName: "app.example.com", RecordType: "A", Targets: []string{"192.0.2.1", "192.0.2.2"}, RecordTTL: 300},
+			{DNSName: "alias.example.com", RecordType: "CNAME", Targets: []string{"app.example.com"}, RecordTTL: 300},
+			{DNSName: "other.example.org", RecordType: "A", Targets: []string{"192.0.2.9"}},
+		},
+	}
+	if resp := do(t, http.MethodPost, ts.URL+"/records", changes, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", resp.StatusCode)
+	}
+
+	if got := len(fake.Policies()); got != 3 {
+		t.Fatalf("Expected 3 policies, got %d", got)
+	}
+
+	changes = webhook.Changes{
+		UpdateOld: []*webhook.Endpoint{
+			{DNSName: "app.example.com", RecordType: "A", Targets: []string{"192.0.2.1", "192.0.2.2"}, RecordTTL: 300},
+		},
+		UpdateNew: []*webhook.Endpoint{
+			{DNSName: "app.example.com", RecordType: "A", Targets: []string{"192.0.2.3"}, RecordTTL: 300},
+		},
+		Delete: []*webhook.Endpoint{
+			{DNSName: "alias.example.com", RecordType: "CNAME", Targets: []string{"app.example.com"}, RecordTTL: 300},
+		},
+	}
+	if resp := do(t, http.MethodPost, ts.URL+"/records", changes, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", resp.StatusCode)
+	}
+
+	var endpoints []*webhook.Endpoint
+	do(t, http.MethodGet, ts.URL+"/records", nil, &endpoints)
+
+	want := []*webhook.Endpoint{
+		{DNSName: "app.example.com", RecordType: "A", Targets: []string{"192.0.2.3"}, RecordTTL: 300},
+	}
+	if !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("Unexpected endpoints after update: %s", dump(endpoints))
+	}
+}
+
+// TestRecordsGroupsTargets tests that records with the same name and type become one endpoint
+func TestRecordsGroupsTargets(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	changes := webhook.Changes{
+		Create: []*webhook.Endpoint{
+			{DNSName: "multi.example.com", RecordType: "A", Targets: []string{"192.0.2.1", "192.0.2.2"}, RecordTTL: 60},
+			{DNSName: "multi.example.com", RecordType: "TXT", Targets: []string{"\"heritage=external-dns\""}},
+			{DNSName: "host.internal.example.com", RecordType: "A", Targets: []string{"192.0.2.5"}},
+		},
+	}
+	do(t, http.MethodPost, ts.URL+"/records", changes, nil)
+
+	var endpoints []*webhook.Endpoint
+	do(t, http.MethodGet, ts.URL+"/records", nil, &endpoints)
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].RecordType < endpoints[j].RecordType })
+
+	want := []*webhook.Endpoint{
+		{DNSName: "multi.example.com", RecordType: "A", Targets: []string{"192.0.2.1", "192.0.2.2"}, RecordTTL: 60},
+		{DNSName: "multi.example.com", RecordType: "TXT", Targets: []string{"\"heritage=external-dns\""}},
+	}
+	if !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("Unexpected endpoints: %s", dump(endpoints))
+	}
+}
+
+// TestAdjustEndpoints tests that unmanageable endpoints are dropped
+func TestAdjustEndpoints(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	endpoints := []*webhook.Endpoint{
+		{DNSName: "App.Example.com.", RecordType: "A", Targets: []string{"192.0.2.1"}, RecordTTL: 300},
+		{DNSName: "txt.example.com", RecordType: "TXT", Targets: []string{"hello"}, RecordTTL: 300},
+		{DNSName: "ns.example.com", RecordType: "NS", Targets: []string{"ns1.example.com"}},
+		{DNSName: "www.example.org", RecordType: "A", Targets: []string{"192.0.2.1"}},
+	}
+
+	var adjusted []*webhook.Endpoint
+	do(t, http.MethodPost, ts.URL+"/adjustendpoints", endpoints, &adjusted)
+
+	want := []*webhook.Endpoint{
+		{DNSName: "app.example.com", RecordType: "A", Targets: []string{"192.0.2.1"}, RecordTTL: 300},
+		{DNSName: "txt.example.com", RecordType: "TXT", Targets: []string{"hello"}},
+	}
+	if !reflect.DeepEqual(adjusted, want) {
+		t.Errorf("Unexpected adjusted endpoints: %s", dump(adjusted))
+	}
+}
+
+// TestHealthHandler tests the liveness and readiness probes
+func TestHealthHandler(t *testing.T) {
+	fake, provider := newProvider(t)
+	server := webhook.New(provider, webhook.DomainFilter{Include: []string{"example.com"}})
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rec := httptest.NewRecorder()
+		server.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", path, rec.Code)
+		}
+	}
+
+	// An invalid API key makes the webhook unready
+	server.Provider = &unifi.Provider{
+		APIKey:  "wrong",
+		SiteId:  fake.SiteID,
+		BaseUrl: fake.BaseURL(),
+	}
+	rec := httptest.NewRecorder()
+	server.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz: expected status 503, got %d", rec.Code)
+	}
+}
+
+func dump(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}